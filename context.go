@@ -0,0 +1,80 @@
+package env
+
+import (
+	"context"
+)
+
+// contextLookup looks up variables with the context of `ParseContext`. Each
+// variable is looked up once in source, as the parser may ask for it several
+// times, and sources without context are only checked against it. The
+// first error stops any further lookup, and is returned by `ParseContext`
+// instead of the parsing errors it causes.
+type contextLookup struct {
+	ctx    context.Context
+	source func(ctx context.Context, key string) (string, bool, error)
+	found  map[string]*string
+	err    error
+}
+
+func (c *contextLookup) wrap(lookup func(key string) (string, bool)) func(key string) (string, bool) {
+	if c.source == nil {
+		return func(key string) (string, bool) {
+			if c.err == nil {
+				c.err = c.ctx.Err()
+			}
+			if c.err != nil {
+				return "", false
+			}
+			return lookup(key)
+		}
+	}
+	if c.found == nil {
+		c.found = make(map[string]*string)
+	}
+	return func(key string) (string, bool) {
+		if value, ok := c.found[key]; ok {
+			if value == nil {
+				return "", false
+			}
+			return *value, true
+		}
+		if c.err != nil {
+			return "", false
+		}
+		if c.err = c.ctx.Err(); c.err != nil {
+			return "", false
+		}
+		value, ok, err := c.source(c.ctx, key)
+		if err != nil {
+			c.err = err
+			return "", false
+		}
+		c.found[key] = nil
+		if ok {
+			c.found[key] = &value
+		}
+		return value, ok
+	}
+}
+
+// ParseContext is the same as `ParseWithOptions`, but passes ctx to
+// `Options.ContextSource`, so that slow lookups, e.g. in a remote secret
+// store, can be cancelled.
+//
+// Once ctx is done, or a lookup fails, no more variables are looked up and
+// the error is returned, e.g. context.DeadlineExceeded when ctx has a timeout.
+// Fields may be partially set by then. A lookup already running is not
+// interrupted unless ContextSource honors ctx itself: sources without
+// context, like the process environment or `Options.Source`, ignore it.
+func ParseContext(ctx context.Context, v interface{}, opts Options) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	lookup := &contextLookup{ctx: ctx, source: opts.ContextSource}
+	opts.lookupCtx = lookup
+	err := ParseWithOptions(v, opts)
+	if lookup.err != nil {
+		return lookup.err
+	}
+	return err
+}
@@ -0,0 +1,93 @@
+package env
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseContext(t *testing.T) {
+	type config struct {
+		Home  string `env:"HOME"`
+		Token string `env:"TOKEN,required"`
+	}
+
+	var seen []string
+	opts := Options{
+		ContextSource: func(ctx context.Context, key string) (string, bool, error) {
+			seen = append(seen, key)
+			if key == "TOKEN" {
+				return "t0k3n", true, nil
+			}
+			return "", false, nil
+		},
+	}
+
+	cfg := &config{}
+	assert.NoError(t, ParseContext(context.Background(), cfg, opts))
+	assert.Equal(t, "t0k3n", cfg.Token)
+	assert.Equal(t, []string{"HOME", "TOKEN"}, seen)
+
+	cfg = &config{}
+	assert.NoError(t, ParseWithOptions(cfg, opts))
+	assert.Equal(t, "t0k3n", cfg.Token)
+}
+
+func TestParseContextTimeout(t *testing.T) {
+	type config struct {
+		Home  string `env:"HOME"`
+		Token string `env:"TOKEN,required"`
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	var seen []string
+	err := ParseContext(ctx, &config{}, Options{
+		ContextSource: func(ctx context.Context, key string) (string, bool, error) {
+			seen = append(seen, key)
+			<-ctx.Done()
+			return "", false, ctx.Err()
+		},
+	})
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Equal(t, []string{"HOME"}, seen)
+}
+
+func TestParseContextCancelled(t *testing.T) {
+	type config struct {
+		Home string `env:"HOME"`
+	}
+
+	os.Setenv("HOME", "/home/me")
+	defer os.Clearenv()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	cfg := &config{}
+	assert.Equal(t, context.Canceled, ParseContext(ctx, cfg, Options{}))
+	assert.Equal(t, "", cfg.Home)
+
+	assert.NoError(t, ParseContext(context.Background(), cfg, Options{}))
+	assert.Equal(t, "/home/me", cfg.Home)
+}
+
+func TestParseContextSourceError(t *testing.T) {
+	type config struct {
+		Token string `env:"TOKEN,required"`
+	}
+
+	errUnreachable := errors.New("secret store unreachable")
+	opts := Options{
+		ContextSource: func(ctx context.Context, key string) (string, bool, error) {
+			return "", false, errUnreachable
+		},
+	}
+	assert.Equal(t, errUnreachable, ParseContext(context.Background(), &config{}, opts))
+	assert.Equal(t, errUnreachable, ValidateWithOptions(config{}, opts))
+}
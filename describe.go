@@ -0,0 +1,86 @@
+package env
+
+import (
+	"encoding/json"
+	"reflect"
+)
+
+// varDescription is the JSON description of a variable, see `Describe`.
+type varDescription struct {
+	Key             string   `json:"key"`
+	Field           string   `json:"field"`
+	Type            string   `json:"type"`
+	Required        bool     `json:"required"`
+	Default         *string  `json:"default,omitempty"`
+	Separator       string   `json:"separator,omitempty"`
+	KeyValSeparator string   `json:"keyValSeparator,omitempty"`
+	Validations     []string `json:"validations,omitempty"`
+	Secret          bool     `json:"secret,omitempty"`
+}
+
+// Describe returns a JSON array describing the variables read by `Parse` for
+// v, a struct or a pointer to a struct, e.g. to generate a configuration UI.
+// Each variable has its key, prefixes included, the name and type of its field,
+// whether it is required, its default value and separators if any, and the
+// validations applied to it. Like `Keys`, it looks nothing up, and reads the
+// `env` tags whatever the `Options.TagName` used to parse v.
+func Describe(v interface{}) (string, error) {
+	refType := reflect.TypeOf(v)
+	if refType != nil && refType.Kind() == reflect.Ptr {
+		refType = refType.Elem()
+	}
+	if refType == nil || refType.Kind() != reflect.Struct {
+		return "", ErrNotAStructPtr
+	}
+
+	descs := []varDescription{}
+	walkVars(refType, "", "", map[reflect.Type]bool{}, func(fp fieldPlan, key string) {
+		descs = append(descs, describe(fp, key))
+	})
+	data, err := json.Marshal(descs)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func describe(fp fieldPlan, key string) varDescription {
+	field := fp.field
+	desc := varDescription{
+		Key:         key,
+		Field:       field.Name,
+		Type:        field.Type.String(),
+		Validations: validations(field, fp.opts, false),
+		Secret:      isSecret(field),
+	}
+	for _, opt := range fp.opts {
+		if opt == "required" || opt == "notEmpty" {
+			desc.Required = true
+		}
+	}
+	if def, ok := field.Tag.Lookup("envDefault"); ok {
+		desc.Default = &def
+	}
+
+	t := field.Type
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map:
+		if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 || field.Tag.Get("envJSON") == "true" || isQuery(field) {
+			break
+		}
+		desc.Separator = field.Tag.Get("envSeparator")
+		if desc.Separator == "" {
+			desc.Separator = ","
+		}
+		if t.Kind() == reflect.Map {
+			desc.KeyValSeparator = field.Tag.Get("envKeyValSeparator")
+			if desc.KeyValSeparator == "" {
+				desc.KeyValSeparator = ":"
+			}
+		}
+	}
+	return desc
+}
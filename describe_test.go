@@ -0,0 +1,76 @@
+package env
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDescribe(t *testing.T) {
+	type server struct {
+		Host string `env:"HOST,required"`
+	}
+	type config struct {
+		Home     string            `env:"HOME"`
+		Port     int               `env:"PORT" envDefault:"3000" envMin:"1" envMax:"65535"`
+		Level    string            `env:"LEVEL,oneof=debug|info" envDefault:""`
+		Token    string            `env:"TOKEN,notEmpty" envSecret:"true"`
+		Hosts    []string          `env:"HOSTS" envSeparator:";"`
+		Labels   map[string]string `env:"LABELS"`
+		Key      []byte            `env:"KEY"`
+		Timeout  time.Duration     `env:"TIMEOUT"`
+		Shell    string            `env:"SHELL,noprefix"`
+		Ignored  string            `env:"-"`
+		NotAnEnv string
+		Inner    *InnerStruct
+		DB       server            `envPrefix:"DB_"`
+		Servers  []server          `envPrefix:"SERVER"`
+		Backends map[string]server `envPrefix:"BACKEND"`
+	}
+
+	desc, err := Describe(&config{})
+	assert.NoError(t, err)
+
+	var vars []map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(desc), &vars))
+	keys := make([]string, 0, len(vars))
+	for _, v := range vars {
+		keys = append(keys, v["key"].(string))
+	}
+	assert.Equal(t, []string{
+		"HOME", "PORT", "LEVEL", "TOKEN", "HOSTS", "LABELS", "KEY", "TIMEOUT",
+		"SHELL", "innervar", "innernum", "DB_HOST", "SERVER_<n>_HOST",
+		"BACKEND_<name>_HOST",
+	}, keys)
+
+	assert.JSONEq(t, `{"key":"HOME","field":"Home","type":"string","required":false}`, mustJSON(t, vars[0]))
+	assert.JSONEq(t, `{"key":"PORT","field":"Port","type":"int","required":false,"default":"3000","validations":["envMin=1","envMax=65535"]}`, mustJSON(t, vars[1]))
+	assert.JSONEq(t, `{"key":"LEVEL","field":"Level","type":"string","required":false,"default":"","validations":["oneof=debug|info"]}`, mustJSON(t, vars[2]))
+	assert.JSONEq(t, `{"key":"TOKEN","field":"Token","type":"string","required":true,"validations":["notEmpty"],"secret":true}`, mustJSON(t, vars[3]))
+	assert.JSONEq(t, `{"key":"HOSTS","field":"Hosts","type":"[]string","required":false,"separator":";"}`, mustJSON(t, vars[4]))
+	assert.JSONEq(t, `{"key":"LABELS","field":"Labels","type":"map[string]string","required":false,"separator":",","keyValSeparator":":"}`, mustJSON(t, vars[5]))
+	assert.JSONEq(t, `{"key":"KEY","field":"Key","type":"[]uint8","required":false}`, mustJSON(t, vars[6]))
+	assert.JSONEq(t, `{"key":"DB_HOST","field":"Host","type":"string","required":true,"validations":["required"]}`, mustJSON(t, vars[11]))
+
+	_, err = Describe(42)
+	assert.Equal(t, ErrNotAStructPtr, err)
+}
+
+func mustJSON(t *testing.T, v interface{}) string {
+	data, err := json.Marshal(v)
+	assert.NoError(t, err)
+	return string(data)
+}
+
+func TestDescribeSelfReferential(t *testing.T) {
+	type node struct {
+		Name string `env:"NAME"`
+		Next *node  `envPrefix:"NEXT_"`
+	}
+
+	desc, err := Describe(&node{})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `[{"key":"NAME","field":"Name","type":"string","required":false}]`, desc)
+}
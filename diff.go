@@ -0,0 +1,72 @@
+package env
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// FieldChange is a variable whose value differs between two configs, see
+// `Diff`.
+type FieldChange struct {
+	// Key is the name of the environment variable
+	Key string
+	// Old is the value in the old config, as formatted by `Marshal`, or
+	// Redacted for a secret
+	Old string
+	// New is the value in the new config, as formatted by `Marshal`, or
+	// Redacted for a secret
+	New string
+}
+
+// Diff compares the fields of old and new, two structs or pointers to structs
+// of the same type, and returns the variables whose value changed, sorted by
+// name. Values are compared as formatted by `Marshal`, so fields without an
+// `env` tag are ignored. The values of the fields tagged with
+// `envSecret:"true"` are compared, but reported as Redacted when not empty.
+func Diff(old, new interface{}) ([]FieldChange, error) {
+	oldVars, secrets, err := marshal(old)
+	if err != nil {
+		return nil, err
+	}
+	newVars, newSecrets, err := marshal(new)
+	if err != nil {
+		return nil, err
+	}
+	oldType := reflect.Indirect(reflect.ValueOf(old)).Type()
+	newType := reflect.Indirect(reflect.ValueOf(new)).Type()
+	if oldType != newType {
+		return nil, fmt.Errorf("Unable to diff values of different types %s and %s", oldType, newType)
+	}
+
+	for key := range newSecrets {
+		secrets[key] = true
+	}
+
+	var changes []FieldChange
+	for key, value := range oldVars {
+		if newValue := newVars[key]; newValue != value {
+			changes = append(changes, FieldChange{Key: key, Old: value, New: newValue})
+		}
+	}
+	for key, value := range newVars {
+		if _, ok := oldVars[key]; !ok && value != "" {
+			changes = append(changes, FieldChange{Key: key, New: value})
+		}
+	}
+	for i, change := range changes {
+		if !secrets[change.Key] {
+			continue
+		}
+		if change.Old != "" {
+			changes[i].Old = Redacted
+		}
+		if change.New != "" {
+			changes[i].New = Redacted
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Key < changes[j].Key
+	})
+	return changes, nil
+}
@@ -0,0 +1,93 @@
+package env
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiff(t *testing.T) {
+	type server struct {
+		Host string `env:"HOST"`
+	}
+	type config struct {
+		DSN      string        `env:"DSN"`
+		Port     int           `env:"PORT"`
+		Timeout  time.Duration `env:"TIMEOUT"`
+		Servers  []server      `envPrefix:"SERVER"`
+		Untagged string
+		private  string
+	}
+
+	old := config{DSN: "postgres://a", Port: 80, Timeout: time.Second, Servers: []server{{Host: "a"}}, Untagged: "a", private: "a"}
+	new := config{DSN: "postgres://b", Port: 80, Timeout: time.Minute, Servers: []server{{Host: "a"}, {Host: "b"}}, Untagged: "b", private: "b"}
+
+	changes, err := Diff(&old, new)
+	assert.NoError(t, err)
+	assert.Equal(t, []FieldChange{
+		{Key: "DSN", Old: "postgres://a", New: "postgres://b"},
+		{Key: "SERVER_1_HOST", New: "b"},
+		{Key: "TIMEOUT", Old: "1s", New: "1m0s"},
+	}, changes)
+
+	changes, err = Diff(new, &new)
+	assert.NoError(t, err)
+	assert.Empty(t, changes)
+
+	changes, err = Diff(new, old)
+	assert.NoError(t, err)
+	assert.Equal(t, FieldChange{Key: "SERVER_1_HOST", Old: "b"}, changes[1])
+
+	_, err = Diff(old, server{})
+	assert.Error(t, err)
+
+	_, err = Diff(nil, old)
+	assert.Equal(t, ErrNotAStructPtr, err)
+}
+
+func TestDiffUnexported(t *testing.T) {
+	type inner struct {
+		Host string `env:"HOST"`
+	}
+	type config struct {
+		Port    int       `env:"PORT"`
+		created time.Time `env:"CREATED"`
+		inner
+	}
+
+	old := config{Port: 80, created: time.Unix(0, 0), inner: inner{Host: "a"}}
+	new := config{Port: 81, created: time.Unix(1, 0), inner: inner{Host: "b"}}
+
+	changes, err := Diff(old, new)
+	assert.NoError(t, err)
+	assert.Equal(t, []FieldChange{{Key: "PORT", Old: "80", New: "81"}}, changes)
+}
+
+func TestDiffSecret(t *testing.T) {
+	type server struct {
+		Token string `env:"TOKEN" envSecret:"true"`
+	}
+	type config struct {
+		Password string   `env:"PASSWORD" envSecret:"true"`
+		APIKey   string   `env:"API_KEY" envSecret:"true"`
+		User     string   `env:"USER"`
+		Servers  []server `envPrefix:"SERVER"`
+	}
+
+	old := config{Password: "hunter2", User: "admin"}
+	new := config{Password: "hunter3", APIKey: "s3cr3t", User: "root", Servers: []server{{Token: "abc"}}}
+
+	changes, err := Diff(old, new)
+	assert.NoError(t, err)
+	assert.Equal(t, []FieldChange{
+		{Key: "API_KEY", New: Redacted},
+		{Key: "PASSWORD", Old: Redacted, New: Redacted},
+		{Key: "SERVER_0_TOKEN", New: Redacted},
+		{Key: "USER", Old: "admin", New: "root"},
+	}, changes)
+
+	changes, err = Diff(new, old)
+	assert.NoError(t, err)
+	assert.Equal(t, FieldChange{Key: "API_KEY", Old: Redacted}, changes[0])
+}
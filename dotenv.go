@@ -0,0 +1,104 @@
+package env
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// ParseReader is the same as `Parse` except it reads variables from r, in the
+// format of a .env file, falling back to the process environment for the
+// variables r does not set. See `ReadDotEnv` for the format, and
+// `Options.Sources` to let the process environment win instead.
+func ParseReader(v interface{}, r io.Reader) error {
+	vars, err := ReadDotEnv(r)
+	if err != nil {
+		return err
+	}
+	return ParseWithOptions(v, Options{
+		Sources: []func(key string) (string, bool){MapSource(vars), os.LookupEnv},
+		SourceKeys: func() []string {
+			keys := MapSourceKeys(vars)()
+			for _, key := range environKeys() {
+				if _, ok := vars[key]; !ok {
+					keys = append(keys, key)
+				}
+			}
+			return keys
+		},
+	})
+}
+
+// ReadDotEnv reads the KEY=VALUE lines of r, in the format of a .env file.
+// Blank lines and lines starting with # are skipped, and a leading `export` is
+// ignored. Values may be quoted: double quotes support the \n, \t, \" and \\
+// escapes, single quotes keep their content as is. Unquoted values end at the
+// first " #", which starts a comment.
+func ReadDotEnv(r io.Reader) (map[string]string, error) {
+	vars := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		i := strings.Index(line, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("Unable to parse line %d: expected KEY=VALUE", n)
+		}
+		key := strings.TrimSpace(line[:i])
+		if key == "" || strings.ContainsAny(key, " \t") {
+			return nil, fmt.Errorf("Unable to parse line %d: invalid key %q", n, key)
+		}
+		value, err := parseDotEnvValue(strings.TrimSpace(line[i+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("Unable to parse line %d: %v", n, err)
+		}
+		vars[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return vars, nil
+}
+
+func parseDotEnvValue(s string) (string, error) {
+	if s == "" || (s[0] != '"' && s[0] != '\'') {
+		if i := strings.Index(s, " #"); i >= 0 {
+			s = s[:i]
+		}
+		return strings.TrimSpace(s), nil
+	}
+
+	quote := s[0]
+	var value strings.Builder
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == quote:
+			rest := strings.TrimSpace(s[i+1:])
+			if rest != "" && !strings.HasPrefix(rest, "#") {
+				return "", fmt.Errorf("unexpected %q after quoted value", rest)
+			}
+			return value.String(), nil
+		case c == '\\' && quote == '"' && i+1 < len(s):
+			i++
+			switch s[i] {
+			case 'n':
+				value.WriteByte('\n')
+			case 't':
+				value.WriteByte('\t')
+			default:
+				value.WriteByte(s[i])
+			}
+		default:
+			value.WriteByte(c)
+		}
+	}
+	return "", errors.New("unterminated quoted value")
+}
@@ -0,0 +1,113 @@
+package env
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadDotEnv(t *testing.T) {
+	vars, err := ReadDotEnv(strings.NewReader(`
+# a comment
+HOME=/home/me
+export PORT = 8080
+EMPTY=
+COMMENTED=value # not a comment part
+HASH=a#b
+DOUBLE="hello \"world\"\nbye" # comment
+SINGLE='raw \n value'
+SPACES="  kept  "
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"HOME":      "/home/me",
+		"PORT":      "8080",
+		"EMPTY":     "",
+		"COMMENTED": "value",
+		"HASH":      "a#b",
+		"DOUBLE":    "hello \"world\"\nbye",
+		"SINGLE":    `raw \n value`,
+		"SPACES":    "  kept  ",
+	}, vars)
+}
+
+func TestReadDotEnvErrors(t *testing.T) {
+	for input, expected := range map[string]string{
+		"HOME=/home\nNOEQUALS":    "Unable to parse line 2: expected KEY=VALUE",
+		"\n\n=value":              "Unable to parse line 3: invalid key \"\"",
+		"MY KEY=value":            "Unable to parse line 1: invalid key \"MY KEY\"",
+		`QUOTED="unterminated`:    "Unable to parse line 1: unterminated quoted value",
+		`QUOTED="value" trailing`: "Unable to parse line 1: unexpected \"trailing\" after quoted value",
+		"OK=1\n# c\nSINGLE='open": "Unable to parse line 3: unterminated quoted value",
+	} {
+		_, err := ReadDotEnv(strings.NewReader(input))
+		assert.EqualError(t, err, expected, input)
+	}
+}
+
+func TestParseReader(t *testing.T) {
+	type config struct {
+		Home  string   `env:"HOME"`
+		Port  int      `env:"PORT"`
+		Hosts []string `env:"HOSTS"`
+		User  string   `env:"USER"`
+	}
+
+	os.Setenv("PORT", "9090")
+	os.Setenv("USER", "me")
+	defer os.Clearenv()
+
+	cfg := &config{}
+	assert.NoError(t, ParseReader(cfg, strings.NewReader("HOME=/home/me\nPORT=8080\nHOSTS=\"a,b\"\n")))
+	assert.Equal(t, &config{
+		Home:  "/home/me",
+		Port:  8080,
+		Hosts: []string{"a", "b"},
+		User:  "me",
+	}, cfg)
+
+	err := ParseReader(cfg, strings.NewReader("HOME"))
+	assert.EqualError(t, err, "Unable to parse line 1: expected KEY=VALUE")
+}
+
+func TestParseWithOptionsSources(t *testing.T) {
+	type config struct {
+		Home string `env:"HOME"`
+		Port int    `env:"PORT"`
+		User string `env:"USER"`
+	}
+
+	os.Setenv("PORT", "9090")
+	defer os.Clearenv()
+
+	fromFile, err := ReadDotEnv(strings.NewReader("HOME=/home/me\nPORT=8080\n"))
+	assert.NoError(t, err)
+
+	cfg := &config{}
+	assert.NoError(t, ParseWithOptions(cfg, Options{
+		Sources: []func(string) (string, bool){os.LookupEnv, MapSource(fromFile)},
+	}))
+	assert.Equal(t, &config{Home: "/home/me", Port: 9090}, cfg)
+
+	cfg = &config{}
+	assert.NoError(t, ParseWithOptions(cfg, Options{
+		Sources: []func(string) (string, bool){MapSource(fromFile), os.LookupEnv},
+	}))
+	assert.Equal(t, &config{Home: "/home/me", Port: 8080}, cfg)
+
+	cfg = &config{}
+	assert.NoError(t, ParseWithOptions(cfg, Options{
+		Source:  MapSource(map[string]string{"USER": "me"}),
+		Sources: []func(string) (string, bool){MapSource(fromFile)},
+	}))
+	assert.Equal(t, &config{User: "me"}, cfg)
+
+	err = ParseWithOptions(&config{}, Options{
+		Prefix:  "X",
+		Strict:  true,
+		Sources: []func(string) (string, bool){MapSource(fromFile)},
+	})
+	assert.EqualError(t, err, "Strict mode needs SourceKeys to list the variables of Source")
+}
@@ -1,13 +1,28 @@
 package env
 
 import (
+	"context"
+	"encoding"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net"
+	"net/url"
 	"os"
 	"reflect"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
 )
 
 var (
@@ -19,39 +34,594 @@ var (
 	// ErrUnsupportedSliceType if the slice element type is not supported by env
 	ErrUnsupportedSliceType = errors.New("Unsupported slice type")
 	// Friendly names for reflect types
-	sliceOfInts      = reflect.TypeOf([]int(nil))
-	sliceOfInt64s    = reflect.TypeOf([]int64(nil))
-	sliceOfUint64s   = reflect.TypeOf([]uint64(nil))
-	sliceOfStrings   = reflect.TypeOf([]string(nil))
-	sliceOfBools     = reflect.TypeOf([]bool(nil))
-	sliceOfFloat32s  = reflect.TypeOf([]float32(nil))
-	sliceOfFloat64s  = reflect.TypeOf([]float64(nil))
-	sliceOfDurations = reflect.TypeOf([]time.Duration(nil))
+	sliceOfInts       = reflect.TypeOf([]int(nil))
+	sliceOfInt64s     = reflect.TypeOf([]int64(nil))
+	sliceOfUint64s    = reflect.TypeOf([]uint64(nil))
+	sliceOfStrings    = reflect.TypeOf([]string(nil))
+	sliceOfBools      = reflect.TypeOf([]bool(nil))
+	sliceOfFloat32s   = reflect.TypeOf([]float32(nil))
+	sliceOfFloat64s   = reflect.TypeOf([]float64(nil))
+	sliceOfDurations  = reflect.TypeOf([]time.Duration(nil))
+	sliceOfIPs        = reflect.TypeOf([]net.IP(nil))
+	sliceOfComplex    = reflect.TypeOf([]complex128(nil))
+	sliceOfTimes      = reflect.TypeOf([]time.Time(nil))
+	sliceOfMACs       = reflect.TypeOf([]net.HardwareAddr(nil))
+	sliceOfRegexps    = reflect.TypeOf([]*regexp.Regexp(nil))
+	sliceOfBigInts    = reflect.TypeOf([]*big.Int(nil))
+	sliceOfBigFloats  = reflect.TypeOf([]*big.Float(nil))
+	sliceOfFileModes  = reflect.TypeOf([]os.FileMode(nil))
+	mapOfStrings      = reflect.TypeOf(map[string]string(nil))
+	mapOfInts         = reflect.TypeOf(map[string]int(nil))
+	mapOfStringSlices = reflect.TypeOf(map[string][]string(nil))
+	durationType      = reflect.TypeOf(time.Duration(0))
+	timeType          = reflect.TypeOf(time.Time{})
+	ipType            = reflect.TypeOf(net.IP(nil))
+	ipNetType         = reflect.TypeOf((*net.IPNet)(nil))
+	macType           = reflect.TypeOf(net.HardwareAddr(nil))
+	urlType           = reflect.TypeOf(url.URL{})
+	urlPtrType        = reflect.TypeOf((*url.URL)(nil))
+	urlValuesType     = reflect.TypeOf(url.Values(nil))
+	regexpPtrType     = reflect.TypeOf((*regexp.Regexp)(nil))
+	bigIntType        = reflect.TypeOf(big.Int{})
+	bigFloatType      = reflect.TypeOf(big.Float{})
+	fileModeType      = reflect.TypeOf(os.FileMode(0))
+	locationPtrType   = reflect.TypeOf((*time.Location)(nil))
+
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	envSetterType       = reflect.TypeOf((*EnvSetter)(nil)).Elem()
 )
 
+// EnvSetter is implemented by types which set themselves from the raw value of
+// an environment variable. It takes precedence over the built-in handling of
+// the type, including `encoding.TextUnmarshaler`, but not over custom parsers.
+type EnvSetter interface {
+	SetEnv(value string) error
+}
+
 // CustomParsers is a friendly name for the type that `ParseWithFuncs()` accepts
 type CustomParsers map[reflect.Type]ParserFunc
 
 // ParserFunc defines the signature of a function that can be used within `CustomParsers`
 type ParserFunc func(v string) (interface{}, error)
 
+// Constructor builds the implementation of an interface selected by the value
+// of a variable, see `Options.Constructors`.
+type Constructor func() (interface{}, error)
+
+// StructFieldParsers maps types to parsers which also receive the struct field
+// being parsed, e.g. to read custom tags.
+type StructFieldParsers map[reflect.Type]StructFieldParserFunc
+
+// StructFieldParserFunc is a `ParserFunc` which also receives the struct field
+// being parsed.
+type StructFieldParserFunc func(v string, field reflect.StructField) (interface{}, error)
+
+// ParseError is returned when the value of an environment variable cannot be
+// converted into its struct field.
+type ParseError struct {
+	// Field is the name of the struct field
+	Field string
+	// Key is the name of the environment variable
+	Key string
+	// Value is the raw string that failed to be parsed
+	Value string
+	// Err is the underlying error
+	Err error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("Unable to parse %s=%q into field %s: %v", e.Key, e.Value, e.Field, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is a *ParseError about the same field and
+// variable, so that errors.Is(err, &ParseError{Field: "Port"}) tells whether
+// the field Port failed. Empty fields of target match anything.
+func (e *ParseError) Is(target error) bool {
+	t, ok := target.(*ParseError)
+	if !ok || t.Err != nil || t.Value != "" {
+		return false
+	}
+	return (t.Field == "" || t.Field == e.Field) && (t.Key == "" || t.Key == e.Key)
+}
+
+// ParseErrors lists the values which could not be converted into their
+// fields, see `AggregateError.ParseErrors`.
+type ParseErrors []ParseError
+
+func (p ParseErrors) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d environment variables could not be parsed:", len(p))
+	for i := range p {
+		b.WriteString("\n\t")
+		b.WriteString(p[i].Error())
+	}
+	return b.String()
+}
+
+// Unwrap returns each ParseError, so errors.Is and errors.As can look into
+// them.
+func (p ParseErrors) Unwrap() []error {
+	errs := make([]error, 0, len(p))
+	for i := range p {
+		errs = append(errs, &p[i])
+	}
+	return errs
+}
+
+// Is reports whether one of the ParseErrors matches target, for the versions
+// of errors.Is which do not follow Unwrap() []error, before Go 1.20.
+func (p ParseErrors) Is(target error) bool {
+	for i := range p {
+		if errors.Is(&p[i], target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first of the ParseErrors matching target, for the versions of
+// errors.As which do not follow Unwrap() []error, before Go 1.20.
+func (p ParseErrors) As(target interface{}) bool {
+	for i := range p {
+		if errors.As(&p[i], target) {
+			return true
+		}
+	}
+	return false
+}
+
+// Fields returns the names of the fields which failed, without duplicates.
+func (p ParseErrors) Fields() []string {
+	var fields []string
+	seen := make(map[string]bool, len(p))
+	for _, e := range p {
+		if !seen[e.Field] {
+			seen[e.Field] = true
+			fields = append(fields, e.Field)
+		}
+	}
+	return fields
+}
+
+// Options holds the settings accepted by `ParseWithOptions()`. The zero value
+// behaves like `Parse`.
+type Options struct {
+	// Prefix is added to the name of every environment variable.
+	Prefix string
+	// Prefixes, if set, replace Prefix with a list of prefixes tried in order
+	// for each field, e.g. {"MYAPP_", ""} reads MYAPP_PORT, then PORT. The
+	// first prefix under which the variable is set wins, and the default
+	// applies only if none has it. Slices and maps of structs only use the
+	// first prefix.
+	Prefixes []string
+	// CustomParsers are used to parse the types they are registered for. The
+	// map is only read, so it can be shared between concurrent calls.
+	CustomParsers CustomParsers
+	// StructFieldParsers are used like CustomParsers, but also receive the
+	// struct field. They take precedence over CustomParsers.
+	StructFieldParsers StructFieldParsers
+	// FieldParsers are used to parse the fields they are registered for, by
+	// struct field name. They take precedence over type parsers.
+	FieldParsers map[string]ParserFunc
+	// Constructors maps interface types to the constructors of their
+	// implementations, by name. An interface field is set with the
+	// constructor named by its variable, and the implementation is then
+	// parsed too if it is a pointer to a struct.
+	Constructors map[reflect.Type]map[string]Constructor
+	// FallbackParser, if set, is called for the fields whose type is not
+	// supported, instead of failing with ErrUnsupportedType. If it returns
+	// handled, the value it returns is set to the field, or the element of a
+	// pointer field, and must be assignable to it. Otherwise the field fails
+	// as if there were no FallbackParser.
+	FallbackParser func(field reflect.StructField, value string) (reflect.Value, bool, error)
+	// Enums maps integer types to the names of their values, e.g. "info" for
+	// the LogLevel 1, so that the fields of these types are read by name.
+	// Unknown names are errors. CustomParsers take precedence.
+	Enums map[reflect.Type]map[string]int64
+	// Groups are checked after the fields are parsed, see `KeyGroup`.
+	Groups []KeyGroup
+	// ExportDefaults makes the parser write the value of every field set from
+	// its `envDefault` tag back to the environment with Setenv, so that child
+	// processes inherit it. Variables which are set are left alone.
+	ExportDefaults bool
+	// Setenv is used by ExportDefaults instead of os.Setenv.
+	Setenv func(key, value string) error
+	// RequiredMessage, if set, formats the error of a required variable which
+	// is not set.
+	RequiredMessage func(key string) string
+	// EmptyMessage, if set, formats the error of a `notEmpty` variable which
+	// is empty.
+	EmptyMessage func(key string) string
+	// OneOfMessage, if set, formats the error of a `oneof` variable whose
+	// value is not allowed.
+	OneOfMessage func(key, value string, allowed []string) string
+	// Strict makes the parser fail if a variable starting with Prefix is not
+	// read by any field, which usually means a typo. It is ignored without
+	// Prefix, and needs SourceKeys if Source is set.
+	Strict bool
+	// Consumed, if set, gets a ConsumedKey appended for every variable looked
+	// up by the parser, found or not.
+	Consumed *[]ConsumedKey
+	// TagName replaces "env" as the name of the tags read by the parser,
+	// including the name of the companion tags: with "config", the default
+	// value is read from the `configDefault` tag. Defaults to "env".
+	TagName string
+	// CollectAllErrors makes the parser go through every field, even after a
+	// failure, and return all the errors at once as an *AggregateError.
+	CollectAllErrors bool
+	// RequiredIfNoDef makes every tagged field without an `envDefault` tag
+	// required, unless it has the `optional` option.
+	RequiredIfNoDef bool
+	// Profile selects the defaults listed by the `envDefaultProfiles` tags,
+	// like "dev=localhost;prod=db.internal". The `envDefault` tag, if any,
+	// applies when the profile is not listed.
+	Profile string
+	// SkipNonEmpty leaves the fields which are not zero alone when their
+	// variable is not set, so that neither their default nor `required`
+	// apply, e.g. to reparse a configuration layered over other sources. A
+	// field is zero as told by reflect.Value.IsZero: 0, "", false, nil
+	// pointers, slices and maps, and structs whose fields are all zero.
+	SkipNonEmpty bool
+	// OnSet, if set, is called after each field is set, with the name of the
+	// field, the name of the variable and its raw value. fromDefault tells
+	// whether the value comes from the `envDefault` tag.
+	OnSet func(field, key, value string, fromDefault bool)
+	// OnDefault, if set, is called before OnSet for each field set from its
+	// `envDefault` tag, with the name of the field, the name of the variable
+	// and the default value.
+	OnDefault func(field, key, value string)
+	// OnDeprecated is called when a variable tagged with `envDeprecated` is
+	// set, with its name and the message of the tag. It defaults to logging a
+	// warning with the standard logger.
+	OnDeprecated func(key, message string)
+	// Source is used to look up variables instead of os.LookupEnv.
+	Source func(key string) (string, bool)
+	// Sources are looked up in order, the first one having a variable wins,
+	// e.g. {os.LookupEnv, MapSource(fromFile)} makes the process environment
+	// override a file. They are ignored if Source is set.
+	Sources []func(key string) (string, bool)
+	// ContextSource is used to look up variables instead of Source and
+	// Sources, with the context given to `ParseContext`, or
+	// context.Background() otherwise. An error aborts parsing and is
+	// returned as is.
+	ContextSource func(ctx context.Context, key string) (string, bool, error)
+	// SourceKeys lists the variables available in Source, Sources or
+	// ContextSource. It is only needed by features enumerating variables,
+	// like CaseInsensitive.
+	SourceKeys func() []string
+	// CaseInsensitive makes the parser retry a variable which is not found
+	// with a case-insensitive match. It only applies to the process
+	// environment or to a Source having SourceKeys.
+	CaseInsensitive bool
+	// DefaultProviders compute the default value of the fields which have no
+	// `envDefault` tag, when their variable is not set. They are looked up by
+	// variable name, prefix included, then by struct field name. An error is
+	// reported as a *ParseError of the field.
+	DefaultProviders map[string]func() (string, error)
+	// BoolValues maps additional words to the value they stand for in bool
+	// fields and []bool elements, e.g. {"yes": true, "off": false}. Words
+	// are matched regardless of case, before falling back to
+	// strconv.ParseBool. They apply to every field.
+	BoolValues map[string]bool
+
+	// known collects the names of the variables fields may be read from, for
+	// Strict.
+	known map[string]bool
+	// report, if set, gets the outcome of every field, for ParseWithReport.
+	report *Report
+	// lookupCtx, if set, wraps the lookups with the context of ParseContext.
+	lookupCtx *contextLookup
+	// dryRun is set by Validate, so that parsing has no side effect on the
+	// environment and does not warn about deprecated variables.
+	dryRun bool
+}
+
+// ConsumedKey is a variable looked up by the parser, see `Options.Consumed`.
+type ConsumedKey struct {
+	// Key is the name of the environment variable
+	Key string
+	// Found tells whether the variable is set. It is false for a field set
+	// from its `envDefault` tag.
+	Found bool
+}
+
+func (o Options) lookup() func(key string) (string, bool) {
+	lookup := o.Source
+	if lookup == nil && len(o.Sources) > 0 {
+		lookup = chainSources(o.Sources)
+	}
+	if lookup == nil {
+		lookup = os.LookupEnv
+	}
+	if o.lookupCtx != nil {
+		lookup = o.lookupCtx.wrap(lookup)
+	}
+	if o.CaseInsensitive {
+		return caseInsensitiveLookup(lookup, o.sourceKeys())
+	}
+	return lookup
+}
+
+func (o Options) setenv() func(key, value string) error {
+	if o.Setenv != nil {
+		return o.Setenv
+	}
+	return os.Setenv
+}
+
+// unsetenv removes the variable of an `unset` field once it is parsed, unless
+// it comes from another source than the process environment or parsing is a
+// dry run. With CaseInsensitive, the variable removed is the one read, which
+// may be cased differently than key.
+func (o Options) unsetenv(key string) {
+	if o.dryRun || o.hasSource() {
+		return
+	}
+	if o.CaseInsensitive {
+		if k, ok := caseInsensitiveKey(key, os.LookupEnv, environKeys); ok {
+			key = k
+		}
+	}
+	os.Unsetenv(key)
+}
+
+func (o Options) deprecated(key, message string) {
+	if o.dryRun {
+		return
+	}
+	if o.OnDeprecated != nil {
+		o.OnDeprecated(key, message)
+		return
+	}
+	log.Printf("env: %s is deprecated: %s", key, message)
+}
+
+// parsers returns CustomParsers, completed with a parser for each of the Enums
+// which doesn't have one.
+func (o Options) parsers() CustomParsers {
+	if len(o.Enums) == 0 {
+		return o.CustomParsers
+	}
+	funcMap := make(CustomParsers, len(o.CustomParsers)+len(o.Enums))
+	for t, enum := range o.Enums {
+		funcMap[t] = enumParser(t, enum)
+	}
+	for t, parserFunc := range o.CustomParsers {
+		funcMap[t] = parserFunc
+	}
+	return funcMap
+}
+
+// enumParser returns a parser reading a value of the integer type t by its
+// name in enum.
+func enumParser(t reflect.Type, enum map[string]int64) ParserFunc {
+	return func(v string) (interface{}, error) {
+		n, ok := enum[v]
+		if !ok {
+			names := make([]string, 0, len(enum))
+			for name := range enum {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return nil, fmt.Errorf("Unknown %s %q, expected one of %s", t, v, strings.Join(names, ", "))
+		}
+		ret := reflect.New(t).Elem()
+		switch t.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			ret.SetInt(n)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			ret.SetUint(uint64(n))
+		default:
+			return nil, fmt.Errorf("Enum type %s is not an integer", t)
+		}
+		return ret.Interface(), nil
+	}
+}
+
+// defaultProvider returns the provider of the default value of a field, if
+// any.
+func (o Options) defaultProvider(field, key string) func() (string, error) {
+	if provider, ok := o.DefaultProviders[key]; ok {
+		return provider
+	}
+	return o.DefaultProviders[field]
+}
+
+// notify calls OnDefault and OnSet, if set, once a field is set.
+func (o Options) notify(field, key, value string, fromDefault bool) {
+	if fromDefault && o.OnDefault != nil {
+		o.OnDefault(field, key, value)
+	}
+	if o.OnSet != nil {
+		o.OnSet(field, key, value, fromDefault)
+	}
+}
+
+// sourceKeys returns a function listing the variables of the source, or nil
+// if the source cannot be listed.
+func (o Options) sourceKeys() func() []string {
+	if !o.hasSource() {
+		return environKeys
+	}
+	return o.SourceKeys
+}
+
+// hasSource tells whether variables are looked up somewhere else than in the
+// process environment.
+func (o Options) hasSource() bool {
+	return o.Source != nil || len(o.Sources) > 0 || o.ContextSource != nil
+}
+
+// chainSources returns a lookup trying each source in order.
+func chainSources(sources []func(key string) (string, bool)) func(key string) (string, bool) {
+	return func(key string) (string, bool) {
+		for _, source := range sources {
+			if value, ok := source(key); ok {
+				return value, true
+			}
+		}
+		return "", false
+	}
+}
+
+func environKeys() []string {
+	environ := os.Environ()
+	keys := make([]string, 0, len(environ))
+	for _, kv := range environ {
+		if i := strings.Index(kv, "="); i > 0 {
+			keys = append(keys, kv[:i])
+		}
+	}
+	return keys
+}
+
+// caseInsensitiveLookup returns a lookup which, when key is not found, retries
+// with the listed variables matching key case-insensitively. If there are
+// several of them, the first one in lexicographic order wins.
+func caseInsensitiveLookup(lookup func(string) (string, bool), list func() []string) func(string) (string, bool) {
+	if list == nil {
+		return lookup
+	}
+	return func(key string) (string, bool) {
+		if value, ok := lookup(key); ok {
+			return value, ok
+		}
+		if k, ok := caseInsensitiveKey(key, lookup, list); ok {
+			return lookup(k)
+		}
+		return "", false
+	}
+}
+
+// caseInsensitiveKey returns the variable read for key by a
+// caseInsensitiveLookup: key itself if it is set, or else the first listed
+// variable matching it case-insensitively.
+func caseInsensitiveKey(key string, lookup func(string) (string, bool), list func() []string) (string, bool) {
+	if _, ok := lookup(key); ok {
+		return key, true
+	}
+	var matches []string
+	for _, k := range list() {
+		if strings.EqualFold(k, key) {
+			matches = append(matches, k)
+		}
+	}
+	if len(matches) == 0 {
+		return "", false
+	}
+	sort.Strings(matches)
+	return matches[0], true
+}
+
+// MapSource returns a function suitable for `Options.Source` or
+// `ParseWithSource()` that looks up variables in m.
+func MapSource(m map[string]string) func(key string) (string, bool) {
+	return func(key string) (string, bool) {
+		v, ok := m[key]
+		return v, ok
+	}
+}
+
+// MapSourceKeys returns a function suitable for `Options.SourceKeys` that
+// lists the variables in m.
+func MapSourceKeys(m map[string]string) func() []string {
+	return func() []string {
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		return keys
+	}
+}
+
+// AggregateError is returned when parsing with `Options.CollectAllErrors`, it
+// holds every error found while parsing.
+type AggregateError struct {
+	Errors []error
+}
+
+func (e *AggregateError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, ". ")
+}
+
+// Unwrap returns the underlying errors, so errors.Is and errors.As can look
+// into them.
+func (e *AggregateError) Unwrap() []error {
+	return e.Errors
+}
+
+// Is reports whether one of the underlying errors matches target, for the
+// versions of errors.Is which do not follow Unwrap() []error, before Go 1.20.
+func (e *AggregateError) Is(target error) bool {
+	for _, err := range e.Errors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first of the underlying errors matching target, for the
+// versions of errors.As which do not follow Unwrap() []error, before Go 1.20.
+func (e *AggregateError) As(target interface{}) bool {
+	for _, err := range e.Errors {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseErrors returns the conversion errors among Errors, leaving out the
+// other ones such as missing required variables. It is nil if there is none.
+func (e *AggregateError) ParseErrors() ParseErrors {
+	var ret ParseErrors
+	for _, err := range e.Errors {
+		var perr *ParseError
+		if errors.As(err, &perr) {
+			ret = append(ret, *perr)
+		}
+	}
+	return ret
+}
+
 // Parse parses a struct containing `env` tags and loads its values from
 // environment variables.
+//
+// Parse and its variants are safe for concurrent use on distinct targets: the
+// only state shared between calls are internal caches, and custom parser maps
+// are only read.
 func Parse(v interface{}) error {
 	return PrefixedParse(v, "")
 }
 
 // PrefixedParse is identical to Parse, except it adds prefix to environment variable names.
 func PrefixedParse(v interface{}, prefix string) error {
-	ptrRef := reflect.ValueOf(v)
-	if ptrRef.Kind() != reflect.Ptr {
-		return ErrNotAStructPtr
+	return ParseWithOptions(v, Options{Prefix: prefix})
+}
+
+// MustParse is the same as `Parse` except it panics with the error, if any.
+func MustParse(v interface{}) {
+	if err := Parse(v); err != nil {
+		panic(err)
 	}
-	ref := ptrRef.Elem()
-	if ref.Kind() != reflect.Struct {
-		return ErrNotAStructPtr
+}
+
+// MustParseWithPrefix is the same as `PrefixedParse` except it panics with the
+// error, if any.
+func MustParseWithPrefix(v interface{}, prefix string) {
+	if err := PrefixedParse(v, prefix); err != nil {
+		panic(err)
 	}
-	return doParse(ref, make(map[reflect.Type]ParserFunc, 0), prefix)
 }
 
 // ParseWithFuncs is the same as `Parse` except it also allows the user to pass
@@ -63,6 +633,125 @@ func ParseWithFuncs(v interface{}, funcMap CustomParsers) error {
 // ParseWithFuncs is the same as `Parse` except it also allows the user to pass
 // in custom parsers.
 func PrefixedParseWithFuncs(v interface{}, funcMap CustomParsers, prefix string) error {
+	return ParseWithOptions(v, Options{Prefix: prefix, CustomParsers: funcMap})
+}
+
+// ParseWithOptions is the same as `Parse` except its behavior can be tuned
+// with opts. The other parse functions are shortcuts for it.
+func ParseWithOptions(v interface{}, opts Options) error {
+	if opts.ContextSource != nil && opts.lookupCtx == nil {
+		return ParseContext(context.Background(), v, opts)
+	}
+	if len(opts.Prefixes) > 0 {
+		opts.Prefix = opts.Prefixes[0]
+	}
+	if opts.Strict {
+		opts.known = knownKeys(reflect.TypeOf(v), opts)
+	}
+	return withCheckErrors(parse(v, opts.parsers(), opts.Prefix, opts), opts)
+}
+
+// ParseWithPrefixes is the same as `Parse` except each variable is looked up
+// with each of prefixes in turn, see `Options.Prefixes`.
+func ParseWithPrefixes(v interface{}, prefixes ...string) error {
+	return ParseWithOptions(v, Options{Prefixes: prefixes})
+}
+
+// ParseWithSource is the same as `Parse` except it looks up variables with
+// source instead of reading the process environment.
+func ParseWithSource(v interface{}, source func(key string) (string, bool)) error {
+	return ParseWithOptions(v, Options{Source: source})
+}
+
+// withCheckErrors adds the errors of the checks done once the fields are
+// parsed, like the groups of opts, to err, the result of parsing, following the
+// same rules as doParse to combine errors.
+func withCheckErrors(err error, opts Options) error {
+	if (len(opts.Groups) == 0 && !opts.Strict) || err == ErrNotAStructPtr || (err != nil && !opts.CollectAllErrors) {
+		return err
+	}
+
+	var errorList []error
+	if err != nil {
+		errorList = appendNestedError(errorList, err)
+	}
+	lookup := opts.lookup()
+	for _, group := range opts.Groups {
+		if err := group.check(opts.Prefix, lookup); err != nil {
+			errorList = append(errorList, err)
+		}
+	}
+	if opts.Strict {
+		if err := checkUnknownKeys(opts); err != nil {
+			errorList = append(errorList, err)
+		}
+	}
+
+	switch {
+	case len(errorList) == 0:
+		return nil
+	case opts.CollectAllErrors:
+		return &AggregateError{Errors: errorList}
+	case len(errorList) == 1:
+		return errorList[0]
+	}
+	return errors.New((&AggregateError{Errors: errorList}).Error())
+}
+
+// knownKeys returns the variables which may be read for t, a pointer to a
+// struct, including those of the structs behind nil pointers which parsing
+// doesn't visit. The variables of the elements of slices and maps of structs
+// are added by get as they are parsed.
+func knownKeys(t reflect.Type, opts Options) map[string]bool {
+	known := make(map[string]bool)
+	if t == nil || t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Struct {
+		return known
+	}
+	walkVars(t.Elem(), opts.Prefix, opts.TagName, map[reflect.Type]bool{}, func(fp fieldPlan, key string) {
+		markKnown(known, fp, strings.TrimSuffix(key, fp.key), key)
+	})
+	return known
+}
+
+// markKnown records key, the variable of fp, as known, along with the other
+// names it may be read from.
+func markKnown(known map[string]bool, fp fieldPlan, prefix, key string) {
+	known[key] = true
+	if fp.field.Tag.Get("envFile") == "true" {
+		known[key+"_FILE"] = true
+	}
+	if aliases := fp.field.Tag.Get("envAliases"); aliases != "" {
+		for _, alias := range strings.Split(aliases, ",") {
+			known[prefix+alias] = true
+		}
+	}
+}
+
+// checkUnknownKeys reports the variables starting with the prefix of opts
+// which are not known to the parser.
+func checkUnknownKeys(opts Options) error {
+	if opts.Prefix == "" {
+		return nil
+	}
+	list := opts.sourceKeys()
+	if list == nil {
+		return errors.New("Strict mode needs SourceKeys to list the variables of Source")
+	}
+
+	var unknown []string
+	for _, key := range list() {
+		if strings.HasPrefix(key, opts.Prefix) && !opts.known[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+	sort.Strings(unknown)
+	return fmt.Errorf("Unknown environment variables with prefix %s: %s", opts.Prefix, strings.Join(unknown, ", "))
+}
+
+func parse(v interface{}, funcMap CustomParsers, prefix string, opts Options) error {
 	ptrRef := reflect.ValueOf(v)
 	if ptrRef.Kind() != reflect.Ptr {
 		return ErrNotAStructPtr
@@ -71,240 +760,1808 @@ func PrefixedParseWithFuncs(v interface{}, funcMap CustomParsers, prefix string)
 	if ref.Kind() != reflect.Struct {
 		return ErrNotAStructPtr
 	}
-	return doParse(ref, funcMap, prefix)
+	return doParse(ref, funcMap, prefix, opts)
+}
+
+func doParse(ref reflect.Value, funcMap CustomParsers, prefix string, opts Options) error {
+	var errorList []error
+
+	for _, fp := range planFor(ref.Type(), opts.TagName) {
+		field := ref.Field(fp.index)
+		switch fp.kind {
+		case fieldSkip:
+			continue
+		case fieldPtr:
+			if !field.CanSet() {
+				continue
+			}
+			if field.IsNil() {
+				if !initPtr(field, fp.field, prefix, opts) {
+					continue
+				}
+			}
+			err := parse(field.Interface(), funcMap, prefix+fp.field.Tag.Get("envPrefix"), opts)
+			if nil == err {
+				continue
+			}
+			if !opts.CollectAllErrors {
+				return err
+			}
+			errorList = appendNestedError(errorList, err)
+			continue
+		case fieldNested:
+			err := doParse(field, funcMap, prefix+fp.field.Tag.Get("envPrefix"), opts)
+			if nil == err {
+				continue
+			}
+			if !opts.CollectAllErrors {
+				return err
+			}
+			errorList = appendNestedError(errorList, err)
+			continue
+		case fieldStructSlice:
+			if !field.CanSet() {
+				continue
+			}
+			err := handleStructSlice(field, fp.field, funcMap, prefix, opts)
+			if nil == err {
+				continue
+			}
+			if !opts.CollectAllErrors {
+				return err
+			}
+			errorList = appendNestedError(errorList, err)
+			continue
+		case fieldStructMap:
+			if !field.CanSet() {
+				continue
+			}
+			err := handleStructMap(field, fp.field, funcMap, prefix, opts)
+			if nil == err {
+				continue
+			}
+			if !opts.CollectAllErrors {
+				return err
+			}
+			errorList = appendNestedError(errorList, err)
+			continue
+		}
+
+		if fp.tagErr != nil {
+			errorList = append(errorList, fp.tagErr)
+			continue
+		}
+		if opts.SkipNonEmpty && !field.IsZero() && !isSet(fp, prefix, opts) {
+			continue
+		}
+		key, value, fromDefault, err := get(fp, prefix, opts)
+		if err != nil {
+			errorList = append(errorList, err)
+			continue
+		}
+		if value == "" {
+			// set to empty, as opposed to unset without default
+			_, isEmpty := opts.lookup()(key)
+			isEmpty = isEmpty || fromDefault
+			if isRune(fp.field) && isEmpty {
+				errorList = append(errorList, newParseError(fp.field, key, value, errors.New("expected exactly one character, got 0")))
+				continue
+			}
+			if field.Kind() == reflect.Array && field.Len() > 0 {
+				errorList = append(errorList, newParseError(fp.field, key, value, fmt.Errorf("expected %d elements, got 0", field.Len())))
+				continue
+			}
+			if field.Kind() == reflect.Map && field.IsNil() && field.CanSet() && isEmpty {
+				field.Set(reflect.MakeMap(field.Type()))
+			}
+			// a pointer to a slice tells an empty variable from an unset one
+			if isSlicePtr(field.Type()) && field.IsNil() && field.CanSet() {
+				if isEmpty {
+					slice := reflect.New(field.Type().Elem())
+					slice.Elem().Set(reflect.MakeSlice(field.Type().Elem(), 0, 0))
+					field.Set(slice)
+				}
+			}
+			if fp.unset {
+				opts.unsetenv(key)
+			}
+			continue
+		}
+		if constructors, ok := opts.Constructors[field.Type()]; ok && field.Kind() == reflect.Interface {
+			impl, err := construct(field, value, constructors)
+			if err != nil {
+				errorList = append(errorList, newParseError(fp.field, key, value, err))
+				continue
+			}
+			field.Set(impl)
+			if impl.Elem().Kind() == reflect.Ptr && impl.Elem().Elem().Kind() == reflect.Struct {
+				err := doParse(impl.Elem().Elem(), funcMap, prefix+fp.field.Tag.Get("envPrefix"), opts)
+				if err != nil {
+					if !opts.CollectAllErrors {
+						return err
+					}
+					errorList = appendNestedError(errorList, err)
+					continue
+				}
+			}
+			if fp.unset {
+				opts.unsetenv(key)
+			}
+			opts.notify(fp.field.Name, key, value, fromDefault)
+			continue
+		}
+		if parserFunc, ok := opts.FieldParsers[fp.field.Name]; ok {
+			err = handleCustom(field, value, parserFunc)
+		} else {
+			err = set(field, fp.field, value, funcMap, withStructField(opts.StructFieldParsers, fp), opts.BoolValues)
+		}
+		if opts.FallbackParser != nil && (errors.Is(err, ErrUnsupportedType) || errors.Is(err, ErrUnsupportedSliceType)) {
+			err = handleFallback(field, fp.orig, value, opts.FallbackParser, err)
+		}
+		if err == nil {
+			err = checkBounds(field, fp.field)
+		}
+		if err != nil {
+			errorList = append(errorList, newParseError(fp.field, key, value, err))
+			continue
+		}
+		if opts.ExportDefaults && fromDefault && !opts.dryRun {
+			if err := opts.setenv()(key, value); err != nil {
+				errorList = append(errorList, fmt.Errorf("Unable to export default of %s: %v", key, err))
+				continue
+			}
+		}
+		if fp.unset {
+			opts.unsetenv(key)
+		}
+		opts.notify(fp.field.Name, key, value, fromDefault)
+	}
+
+	switch {
+	case len(errorList) == 0:
+		return nil
+	case opts.CollectAllErrors:
+		return &AggregateError{Errors: errorList}
+	case len(errorList) == 1:
+		return errorList[0]
+	}
+	// keep the historical behavior of flattening multiple errors into one
+	return errors.New((&AggregateError{Errors: errorList}).Error())
+}
+
+// construct calls the constructor named value and returns its result as a
+// value of the interface type of field.
+func construct(field reflect.Value, value string, constructors map[string]Constructor) (reflect.Value, error) {
+	constructor, ok := constructors[value]
+	if !ok {
+		names := make([]string, 0, len(constructors))
+		for name := range constructors {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return reflect.Value{}, fmt.Errorf("Unknown implementation %q, expected one of: %s", value, strings.Join(names, ", "))
+	}
+
+	impl, err := constructor()
+	if err != nil {
+		return reflect.Value{}, fmt.Errorf("Constructor error: %v", err)
+	}
+	if impl == nil || !reflect.TypeOf(impl).Implements(field.Type()) {
+		return reflect.Value{}, fmt.Errorf("Constructor %q returned %T, which does not implement %s", value, impl, field.Type())
+	}
+	ret := reflect.New(field.Type()).Elem()
+	ret.Set(reflect.ValueOf(impl))
+	return ret, nil
+}
+
+func appendNestedError(errorList []error, err error) []error {
+	if agg, ok := err.(*AggregateError); ok {
+		return append(errorList, agg.Errors...)
+	}
+	return append(errorList, err)
+}
+
+// isNestedStruct reports whether the field is an exported struct value, or an
+// embedded one, without an `env` tag, whose fields are to be parsed.
+func isNestedStruct(field reflect.StructField) bool {
+	return field.Type.Kind() == reflect.Struct && field.Tag.Get("env") == "" && field.PkgPath == ""
+}
+
+// isStructSlice reports whether the field is a slice of structs to be filled
+// from indexed variables, i.e. a slice of structs tagged with envPrefix only.
+func isStructSlice(field reflect.StructField) bool {
+	if field.Tag.Get("env") != "" || field.Tag.Get("envPrefix") == "" {
+		return false
+	}
+	return field.Type.Kind() == reflect.Slice && field.Type.Elem().Kind() == reflect.Struct
+}
+
+// handleStructSlice fills a slice of structs from indexed variables: the
+// element at index i reads its fields from PREFIX_i_KEY. It stops at the first
+// index having none of its variables set, leaving the slice nil if there is no
+// element at all.
+func handleStructSlice(field reflect.Value, refType reflect.StructField, funcMap CustomParsers, prefix string, opts Options) error {
+	elemType := field.Type().Elem()
+	slice := reflect.Zero(field.Type())
+
+	for i := 0; ; i++ {
+		elemPrefix := prefix + refType.Tag.Get("envPrefix") + "_" + strconv.Itoa(i) + "_"
+		if !hasAnyVar(elemType, elemPrefix, opts) {
+			break
+		}
+		elem := reflect.New(elemType)
+		if err := doParse(elem.Elem(), funcMap, elemPrefix, opts); err != nil {
+			return err
+		}
+		slice = reflect.Append(slice, elem.Elem())
+	}
+
+	if slice.Len() > 0 {
+		field.Set(slice)
+	}
+	return nil
+}
+
+// isStructMap reports whether the field is a map of structs to be filled from
+// named variables, i.e. a map of structs with string keys tagged with envPrefix
+// only.
+func isStructMap(field reflect.StructField) bool {
+	if field.Tag.Get("env") != "" || field.Tag.Get("envPrefix") == "" {
+		return false
+	}
+	t := field.Type
+	return t.Kind() == reflect.Map && t.Key().Kind() == reflect.String && t.Elem().Kind() == reflect.Struct
+}
+
+// handleStructMap fills a map of structs from named variables: the element
+// NAME reads its fields from PREFIX_NAME_KEY. The names are found by listing
+// the variables of the source which start with PREFIX_ and end with one of the
+// keys of the struct, and are stored in lower case. When a key is a suffix of
+// another one, like PORT of ADMIN_PORT, the longest key wins, so that
+// PREFIX_X_ADMIN_PORT is the element X and never X_ADMIN. The map is left nil
+// if there is no element at all.
+func handleStructMap(field reflect.Value, refType reflect.StructField, funcMap CustomParsers, prefix string, opts Options) error {
+	list := opts.sourceKeys()
+	if list == nil {
+		return errors.New("Unable to find the elements of field " + refType.Name + ": the variables of the source can't be listed without SourceKeys")
+	}
+
+	mapPrefix := prefix + refType.Tag.Get("envPrefix") + "_"
+	elemType := field.Type().Elem()
+	keys := structKeys(elemType, opts.TagName, "")
+	sort.SliceStable(keys, func(i, j int) bool {
+		return len(keys[i]) > len(keys[j])
+	})
+	found := make(map[string]bool)
+	var names []string
+	for _, key := range list() {
+		if !strings.HasPrefix(key, mapPrefix) {
+			continue
+		}
+		rest := strings.TrimPrefix(key, mapPrefix)
+		for _, k := range keys {
+			name := strings.TrimSuffix(rest, "_"+k)
+			if name == rest || name == "" {
+				continue
+			}
+			if !found[name] {
+				found[name] = true
+				names = append(names, name)
+			}
+			break
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	sort.Strings(names)
+
+	m := reflect.MakeMapWithSize(field.Type(), len(names))
+	for _, name := range names {
+		elem := reflect.New(elemType).Elem()
+		if err := doParse(elem, funcMap, mapPrefix+name+"_", opts); err != nil {
+			return err
+		}
+		m.SetMapIndex(reflect.ValueOf(strings.ToLower(name)).Convert(field.Type().Key()), elem)
+	}
+	field.Set(m)
+	return nil
+}
+
+// structKeys lists the variables read for the struct type, prefixed with
+// prefix, going down nested structs.
+func structKeys(t reflect.Type, tagName, prefix string) []string {
+	var keys []string
+	for _, fp := range planFor(t, tagName) {
+		switch {
+		case fp.kind == fieldNested:
+			keys = append(keys, structKeys(fp.field.Type, tagName, prefix+fp.field.Tag.Get("envPrefix"))...)
+		case fp.kind == fieldValue && !fp.noPrefix:
+			keys = append(keys, prefix+fp.key)
+		}
+	}
+	return keys
+}
+
+// hasAnyVar reports whether any variable of the struct type is set, nested
+// structs included.
+func hasAnyVar(refType reflect.Type, prefix string, opts Options) bool {
+	lookup := opts.lookup()
+	for _, key := range structKeys(refType, opts.TagName, prefix) {
+		if _, ok := lookup(key); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// initPtr allocates the nil pointer to a struct field tagged with
+// `envInit:"true"` if any of the variables of the struct is set, and reports
+// whether it did.
+func initPtr(field reflect.Value, refType reflect.StructField, prefix string, opts Options) bool {
+	elemType := field.Type().Elem()
+	if refType.Tag.Get("envInit") != "true" || elemType.Kind() != reflect.Struct {
+		return false
+	}
+	if !hasAnyVar(elemType, prefix+refType.Tag.Get("envPrefix"), opts) {
+		return false
+	}
+	field.Set(reflect.New(elemType))
+	return true
+}
+
+func get(fp fieldPlan, prefix string, options Options) (string, string, bool, error) {
+	if fp.noPrefix {
+		prefix = ""
+	} else if len(options.Prefixes) > 1 {
+		prefix = resolvePrefix(fp, prefix, options)
+	}
+	var (
+		val    string
+		err    error
+		lookup = options.lookup()
+		field  = fp.field
+		opts   = fp.opts
+		key    = prefix + fp.key
+	)
+
+	if options.known != nil {
+		markKnown(options.known, fp, prefix, key)
+	}
+	if aliases := field.Tag.Get("envAliases"); aliases != "" {
+		key = resolveAlias(key, prefix, strings.Split(aliases, ","), lookup)
+	}
+
+	_, direct := lookup(key)
+	if field.Tag.Get("envFile") == "true" {
+		lookup, err = fileLookup(field, key, lookup)
+		if err != nil {
+			return key, "", false, err
+		}
+	}
+	if field.Tag.Get("envExpand") == "true" {
+		lookup = expandLookup(key, lookup)
+	}
+	if field.Tag.Get("envTrim") == "true" {
+		lookup = trimLookup(key, lookup)
+	}
+	if field.Tag.Get("envDefaultOnEmpty") == "true" {
+		lookup = nonEmptyLookup(key, lookup)
+	}
+
+	defaultValue, hasDefault := field.Tag.Lookup("envDefault")
+	if spec, ok := field.Tag.Lookup("envDefaultProfiles"); ok {
+		value, listed, err := profileDefault(spec, options.Profile)
+		if err != nil {
+			return key, "", false, fmt.Errorf("Invalid envDefaultProfiles of field %s: %v", field.Name, err)
+		}
+		if listed {
+			defaultValue, hasDefault = value, true
+		}
+	}
+	presence := field.Tag.Get("envPresence") == "true"
+	if presence {
+		defaultValue, hasDefault = "", false
+	}
+	if hasDefault && field.Tag.Get("envExpand") == "true" {
+		defaultValue = expandDefault(defaultValue, lookup)
+	}
+	val = getOr(key, defaultValue, lookup)
+	_, found := lookup(key)
+	if provider := options.defaultProvider(field.Name, key); provider != nil && !found && !hasDefault && !presence {
+		if val, err = provider(); err != nil {
+			return key, "", false, newParseError(field, key, "", err)
+		}
+		hasDefault = true
+	}
+	if options.Consumed != nil {
+		*options.Consumed = append(*options.Consumed, ConsumedKey{Key: key, Found: found})
+	}
+	if message, ok := field.Tag.Lookup("envDeprecated"); ok && found {
+		options.deprecated(key, message)
+	}
+
+	// an unset presence field is false, not missing
+	requiredIfNoDef := options.RequiredIfNoDef && !hasDefault && !presence && field.Tag.Get("env") != ""
+	var allowed []string
+	if len(opts) > 0 {
+		for _, opt := range opts {
+			switch {
+			case opt == "":
+				break
+			case opt == "required":
+				val, err = getRequired(key, lookup, options)
+				requiredIfNoDef = false
+			case opt == "notEmpty":
+				val, err = getNotEmpty(key, lookup, options)
+				requiredIfNoDef = false
+			case opt == "optional":
+				requiredIfNoDef = false
+			case opt == "unset", opt == "noprefix":
+				break
+			case strings.HasPrefix(opt, "oneof="):
+				allowed = strings.Split(strings.TrimPrefix(opt, "oneof="), "|")
+			default:
+				err = errors.New("Env tag option " + opt + " not supported.")
+			}
+		}
+	}
+
+	if err == nil && requiredIfNoDef {
+		val, err = getRequired(key, lookup, options)
+	}
+	// after the options, which read the raw value for required and notEmpty
+	if presence && err == nil {
+		val = strconv.FormatBool(found)
+	}
+	if transform, ok := field.Tag.Lookup("envTransform"); ok && err == nil {
+		val, err = applyTransform(transform, val)
+	}
+	if err == nil && val != "" && allowed != nil {
+		err = checkOneOf(field, key, val, allowed, options)
+	}
+	if pattern, ok := field.Tag.Lookup("envMatch"); ok && err == nil && val != "" {
+		err = checkMatch(field, key, val, pattern)
+	}
+	if options.report != nil {
+		source := NotSet
+		switch {
+		case found && !direct:
+			source = FromFile
+		case found:
+			source = FromEnv
+		case hasDefault:
+			source = FromDefault
+		}
+		options.report.add(field, key, val, source, validations(field, opts, requiredIfNoDef))
+	}
+
+	return key, val, hasDefault && !found, err
+}
+
+// compiledPatterns caches the compiled envMatch regexps by pattern.
+var compiledPatterns sync.Map
+
+func checkMatch(field reflect.StructField, key, value, pattern string) error {
+	var re *regexp.Regexp
+	if cached, ok := compiledPatterns.Load(pattern); ok {
+		re = cached.(*regexp.Regexp)
+	} else {
+		var err error
+		re, err = regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("Invalid envMatch pattern %q on field %s: %v", pattern, field.Name, err)
+		}
+		compiledPatterns.Store(pattern, re)
+	}
+
+	if !re.MatchString(value) {
+		return fmt.Errorf("Environment variable %s does not match %q", key, pattern)
+	}
+	return nil
+}
+
+func checkOneOf(field reflect.StructField, key, value string, allowed []string, options Options) error {
+	for _, v := range allowed {
+		if v == value {
+			return nil
+		}
+	}
+	if isSecret(field) {
+		value = Redacted
+	}
+	if options.OneOfMessage != nil {
+		return errors.New(options.OneOfMessage(key, value, allowed))
+	}
+	return fmt.Errorf("Environment variable %s must be one of %s, got %q", key, strings.Join(allowed, ", "), value)
+}
+
+// split the env tag's key into the expected key and desired option, if any.
+func parseKeyForOption(key string) (string, []string) {
+	opts := strings.Split(key, ",")
+	return opts[0], opts[1:]
+}
+
+// resolvePrefix returns prefix with the first of Options.Prefixes, which it
+// starts with, replaced by the first one under which the variable of fp or one
+// of its aliases is set. prefix is returned as is if none is set.
+func resolvePrefix(fp fieldPlan, prefix string, options Options) string {
+	names := []string{fp.key}
+	if aliases := fp.field.Tag.Get("envAliases"); aliases != "" {
+		names = append(names, strings.Split(aliases, ",")...)
+	}
+	rest := strings.TrimPrefix(prefix, options.Prefixes[0])
+	lookup := options.lookup()
+	for _, p := range options.Prefixes {
+		for _, name := range names {
+			if _, ok := lookup(p + rest + name); ok {
+				return p + rest
+			}
+		}
+	}
+	return prefix
+}
+
+// isSet tells whether the variable of fp is set, under its name, one of its
+// aliases or, for `envFile` fields, their _FILE variants.
+func isSet(fp fieldPlan, prefix string, options Options) bool {
+	if fp.noPrefix {
+		prefix = ""
+	} else if len(options.Prefixes) > 1 {
+		prefix = resolvePrefix(fp, prefix, options)
+	}
+	keys := []string{prefix + fp.key}
+	if aliases := fp.field.Tag.Get("envAliases"); aliases != "" {
+		for _, alias := range strings.Split(aliases, ",") {
+			keys = append(keys, prefix+alias)
+		}
+	}
+	if fp.field.Tag.Get("envFile") == "true" {
+		for _, key := range keys {
+			keys = append(keys, key+"_FILE")
+		}
+	}
+	lookup := options.lookup()
+	for _, key := range keys {
+		if _, ok := lookup(key); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveAlias returns the first of key and its aliases which is set, or key
+// if none of them is.
+func resolveAlias(key, prefix string, aliases []string, lookup func(string) (string, bool)) string {
+	if _, ok := lookup(key); ok {
+		return key
+	}
+	for _, alias := range aliases {
+		if _, ok := lookup(prefix + alias); ok {
+			return prefix + alias
+		}
+	}
+	return key
+}
+
+// fileLookup implements the `KEY_FILE` convention: if key is not set but
+// key_FILE is, the returned lookup reports the content of the file it points
+// to as the value of key.
+func fileLookup(field reflect.StructField, key string, lookup func(string) (string, bool)) (func(string) (string, bool), error) {
+	if _, ok := lookup(key); ok {
+		return lookup, nil
+	}
+	path, ok := lookup(key + "_FILE")
+	if !ok {
+		return lookup, nil
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, &ParseError{
+			Field: field.Name,
+			Key:   key + "_FILE",
+			Value: path,
+			Err:   err,
+		}
+	}
+	value := strings.TrimRight(string(content), "\r\n")
+
+	return func(k string) (string, bool) {
+		if k == key {
+			return value, true
+		}
+		return lookup(k)
+	}, nil
+}
+
+// profileName matches the names of the profiles in envDefaultProfiles tags.
+var profileName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// profileDefault returns the default of profile in spec, a list of
+// profile=value entries separated by ";", and whether profile is listed.
+// The whole spec is checked, whatever the profile.
+func profileDefault(spec, profile string) (string, bool, error) {
+	var (
+		value        string
+		ok           bool
+		seenProfiles = make(map[string]bool)
+	)
+	for _, entry := range strings.Split(spec, ";") {
+		kv := strings.SplitN(entry, "=", 2)
+		switch {
+		case len(kv) != 2:
+			return "", false, fmt.Errorf("entry %q is not profile=value", entry)
+		case !profileName.MatchString(kv[0]):
+			return "", false, fmt.Errorf("entry %q has an invalid profile name", entry)
+		case seenProfiles[kv[0]]:
+			return "", false, fmt.Errorf("profile %q is listed twice", kv[0])
+		}
+		seenProfiles[kv[0]] = true
+		if kv[0] == profile {
+			value, ok = kv[1], true
+		}
+	}
+	return value, ok, nil
+}
+
+// expandDefault expands references like ${OTHER} in a default value,
+// resolving them with lookup. Undefined references expand to the empty string,
+// and "$$" stands for a single "$".
+func expandDefault(value string, lookup func(string) (string, bool)) string {
+	return os.Expand(value, func(name string) string {
+		if name == "$" {
+			return "$"
+		}
+		v, _ := lookup(name)
+		return v
+	})
+}
+
+// expandLookup returns a lookup which expands references like ${OTHER} in the
+// value of key, resolving them with lookup itself. Undefined references expand
+// to the empty string.
+func expandLookup(key string, lookup func(string) (string, bool)) func(string) (string, bool) {
+	return func(k string) (string, bool) {
+		value, ok := lookup(k)
+		if !ok || k != key {
+			return value, ok
+		}
+		return os.Expand(value, func(name string) string {
+			v, _ := lookup(name)
+			return v
+		}), true
+	}
+}
+
+// trimLookup returns a lookup which trims surrounding whitespaces from the
+// value of key.
+func trimLookup(key string, lookup func(string) (string, bool)) func(string) (string, bool) {
+	return func(k string) (string, bool) {
+		value, ok := lookup(k)
+		if k == key {
+			value = strings.TrimSpace(value)
+		}
+		return value, ok
+	}
+}
+
+func applyTransform(transform, value string) (string, error) {
+	switch transform {
+	case "upper":
+		return strings.ToUpper(value), nil
+	case "lower":
+		return strings.ToLower(value), nil
+	}
+	return "", errors.New("Env transform " + transform + " not supported.")
+}
+
+// nonEmptyLookup reports key as not set when it is empty, so that the default
+// value applies.
+func nonEmptyLookup(key string, lookup func(string) (string, bool)) func(string) (string, bool) {
+	return func(k string) (string, bool) {
+		value, ok := lookup(k)
+		if k == key && value == "" {
+			return "", false
+		}
+		return value, ok
+	}
+}
+
+func getRequired(key string, lookup func(string) (string, bool), options Options) (string, error) {
+	if value, ok := lookup(key); ok {
+		return value, nil
+	}
+	if options.RequiredMessage != nil {
+		return "", errors.New(options.RequiredMessage(key))
+	}
+	return "", errors.New("Required environment variable " + key + " is not set")
+}
+
+func getNotEmpty(key string, lookup func(string) (string, bool), options Options) (string, error) {
+	value, err := getRequired(key, lookup, options)
+	if err != nil {
+		return "", err
+	}
+	if value == "" {
+		if options.EmptyMessage != nil {
+			return "", errors.New(options.EmptyMessage(key))
+		}
+		return "", errors.New("Environment variable " + key + " is set but empty")
+	}
+	return value, nil
+}
+
+func getOr(key, defaultValue string, lookup func(string) (string, bool)) string {
+	value, ok := lookup(key)
+	if ok {
+		return value
+	}
+	return defaultValue
+}
+
+func set(field reflect.Value, refType reflect.StructField, value string, funcMap CustomParsers, fieldFuncs StructFieldParsers, bools map[string]bool) error {
+	if refType.Tag.Get("envJSON") == "true" {
+		return handleJSON(field, value)
+	}
+
+	if parserFunc, ok := fieldFuncs[field.Type()]; ok {
+		return handleCustom(field, value, func(v string) (interface{}, error) {
+			return parserFunc(v, refType)
+		})
+	}
+
+	// Does the custom parser func map contain this type?
+	if parserFunc, ok := funcMap[field.Type()]; ok {
+		return handleCustom(field, value, parserFunc)
+	}
+
+	if ok, err := handleEnvSetter(field, value); ok {
+		return err
+	}
+
+	if isSQLNull(field.Type()) {
+		if err := set(field.Field(0), refType, value, funcMap, fieldFuncs, bools); err != nil {
+			return err
+		}
+		field.Field(1).SetBool(true)
+		return nil
+	}
+
+	if field.Kind() == reflect.Int32 && refType.Tag.Get("envRune") == "true" {
+		return handleRune(field, value)
+	}
+
+	if field.Kind() != reflect.Ptr && isQuery(refType) {
+		return handleQuery(field, value)
+	}
+
+	if refType.Tag.Get("envBytes") == "true" && field.Type() != durationType {
+		if ok, err := handleByteSize(field, value); ok {
+			return err
+		}
+	}
+
+	switch field.Type() {
+	case ipType:
+		return handleIP(field, value)
+	case ipNetType:
+		return handleIPNet(field, value)
+	case macType:
+		return handleMAC(field, value)
+	case regexpPtrType:
+		re, err := regexp.Compile(value)
+		if err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(re))
+		return nil
+	case urlType, urlPtrType:
+		return handleURL(field, value)
+	case timeType:
+		return handleTime(field, refType, value)
+	case bigIntType:
+		return handleBigInt(field, value)
+	case bigFloatType:
+		return handleBigFloat(field, value)
+	case fileModeType:
+		mode, err := parseFileMode(value)
+		if err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(mode))
+		return nil
+	case locationPtrType:
+		loc, err := time.LoadLocation(value)
+		if err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(loc))
+		return nil
+	}
+
+	if field.Kind() == reflect.Ptr {
+		return handlePtr(field, refType, value, funcMap, fieldFuncs, bools)
+	}
+
+	if ok, err := handleTextUnmarshaler(field, value); ok {
+		return err
+	}
+
+	switch field.Kind() {
+	case reflect.Slice:
+		if field.Type().Elem().Kind() == reflect.Uint8 {
+			return handleBytes(field, refType, value)
+		}
+		return handleSlice(field, refType, value, funcMap, fieldFuncs, bools)
+	case reflect.Array:
+		return handleArray(field, refType, value, funcMap, fieldFuncs, bools)
+	case reflect.Map:
+		separator := refType.Tag.Get("envSeparator")
+		kvSeparator := refType.Tag.Get("envKeyValSeparator")
+		base, err := intBase(refType)
+		if err != nil {
+			return err
+		}
+		return handleMap(field, value, separator, kvSeparator, base, refType.Tag.Get("envCSV") == "true")
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		bvalue, err := parseBool(value, bools)
+		if err != nil {
+			return err
+		}
+		field.SetBool(bvalue)
+	case reflect.Int:
+		intValue, err := parseInt(value, refType, 32)
+		if err != nil {
+			return err
+		}
+		field.SetInt(intValue)
+	case reflect.Int8, reflect.Int16, reflect.Int32:
+		intValue, err := parseInt(value, refType, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(intValue)
+	case reflect.Uint:
+		uintValue, err := parseUint(value, refType, 32)
+		if err != nil {
+			return err
+		}
+		field.SetUint(uintValue)
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		uintValue, err := parseUint(value, refType, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetUint(uintValue)
+	case reflect.Float32:
+		v, err := parseFloat(value, 32, refType.Tag.Get("envPercent") == "true")
+		if err != nil {
+			return err
+		}
+		field.SetFloat(v)
+	case reflect.Float64:
+		v, err := parseFloat(value, 64, refType.Tag.Get("envPercent") == "true")
+		if err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(v))
+	case reflect.Complex64, reflect.Complex128:
+		v, err := strconv.ParseComplex(value, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetComplex(v)
+	case reflect.Int64:
+		if field.Type() == durationType {
+			dValue, err := parseDuration(value, refType.Tag.Get("envDurationUnit"))
+			if err != nil {
+				return err
+			}
+			field.Set(reflect.ValueOf(dValue))
+		} else {
+			intValue, err := parseInt(value, refType, 64)
+			if err != nil {
+				return err
+			}
+			field.SetInt(intValue)
+		}
+	case reflect.Uint64:
+		uintValue, err := parseUint(value, refType, 64)
+		if err != nil {
+			return err
+		}
+		field.SetUint(uintValue)
+	default:
+		return ErrUnsupportedType
+	}
+	return nil
+}
+
+// checkSeparatorTags reports separator tags which are set but empty. Other
+// separators can be of any length.
+func checkSeparatorTags(field reflect.StructField) error {
+	for _, tag := range []string{"envSeparator", "envKeyValSeparator"} {
+		if separator, ok := field.Tag.Lookup(tag); ok && separator == "" {
+			return errors.New("Tag " + tag + " of field " + field.Name + " must not be empty")
+		}
+	}
+	return nil
+}
+
+// checkPresenceTag reports an error if the envPresence tag is used on a field
+// which is not a bool.
+func checkPresenceTag(field reflect.StructField) error {
+	if field.Tag.Get("envPresence") != "true" {
+		return nil
+	}
+	t := field.Type
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Bool {
+		return nil
+	}
+	return errors.New("Tag envPresence is not supported on field " + field.Name + " of type " + field.Type.String())
+}
+
+// checkBoundsTags reports an error if the envMin or envMax tags are used on a
+// non-numeric field.
+func checkBoundsTags(field reflect.StructField) error {
+	_, hasMin := field.Tag.Lookup("envMin")
+	_, hasMax := field.Tag.Lookup("envMax")
+	if !hasMin && !hasMax {
+		return nil
+	}
+
+	t := field.Type
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return nil
+	}
+	return errors.New("Tags envMin and envMax are not supported on field " + field.Name + " of type " + field.Type.String())
+}
+
+// checkBounds validates the value of a numeric field against its envMin and
+// envMax tags. The bounds of a time.Duration are durations, e.g. "1s". The
+// bounds of an integer are decimal, even when envBase reads its value in
+// another base.
+func checkBounds(field reflect.Value, refType reflect.StructField) error {
+	v := reflect.Indirect(field)
+	for _, tag := range []string{"envMin", "envMax"} {
+		bound, ok := refType.Tag.Lookup(tag)
+		if !ok {
+			continue
+		}
+
+		var (
+			cmp int
+			err error
+		)
+		switch v.Kind() {
+		case reflect.Int64:
+			var b int64
+			if v.Type() == durationType {
+				var d time.Duration
+				d, err = time.ParseDuration(bound)
+				b = int64(d)
+			} else {
+				b, err = strconv.ParseInt(bound, 10, 64)
+			}
+			cmp = compareInt(v.Int(), b)
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32:
+			var b int64
+			b, err = strconv.ParseInt(bound, 10, 64)
+			cmp = compareInt(v.Int(), b)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			var b uint64
+			b, err = strconv.ParseUint(bound, 10, 64)
+			cmp = compareUint(v.Uint(), b)
+		case reflect.Float32, reflect.Float64:
+			var b float64
+			b, err = strconv.ParseFloat(bound, 64)
+			cmp = compareFloat(v.Float(), b)
+		}
+		if err != nil {
+			return fmt.Errorf("Invalid %s %q: %v", tag, bound, err)
+		}
+
+		var shown interface{} = v.Interface()
+		if isSecret(refType) {
+			shown = Redacted
+		}
+		if tag == "envMin" && cmp < 0 {
+			return fmt.Errorf("Value %v is lower than envMin %s", shown, bound)
+		}
+		if tag == "envMax" && cmp > 0 {
+			return fmt.Errorf("Value %v is greater than envMax %s", shown, bound)
+		}
+	}
+	return nil
+}
+
+func compareInt(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func compareUint(a, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func compareFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// withStructField returns parsers which get the field of fp as declared, with
+// all its tags, instead of the one renamed after Options.TagName.
+func withStructField(parsers StructFieldParsers, fp fieldPlan) StructFieldParsers {
+	if len(parsers) == 0 || fp.field.Tag == fp.orig.Tag {
+		return parsers
+	}
+	ret := make(StructFieldParsers, len(parsers))
+	for t, parser := range parsers {
+		parser := parser
+		ret[t] = func(value string, _ reflect.StructField) (interface{}, error) {
+			return parser(value, fp.orig)
+		}
+	}
+	return ret
+}
+
+// handleFallback sets field with the value returned by fallback, or returns
+// unsupported, the error of the unsupported type, if fallback does not handle
+// it.
+func handleFallback(field reflect.Value, refType reflect.StructField, value string, fallback func(reflect.StructField, string) (reflect.Value, bool, error), unsupported error) error {
+	data, handled, err := fallback(refType, value)
+	if err != nil {
+		return err
+	}
+	if !handled {
+		return unsupported
+	}
+	switch {
+	case !data.IsValid():
+		return fmt.Errorf("FallbackParser returned no value for %s", field.Type())
+	case data.Type().AssignableTo(field.Type()):
+		field.Set(data)
+	case field.Kind() == reflect.Ptr && data.Type().AssignableTo(field.Type().Elem()):
+		ptr := reflect.New(field.Type().Elem())
+		ptr.Elem().Set(data)
+		field.Set(ptr)
+	default:
+		return fmt.Errorf("FallbackParser returned a %s, which is not assignable to %s", data.Type(), field.Type())
+	}
+	return nil
+}
+
+func handleCustom(field reflect.Value, value string, parserFunc ParserFunc) error {
+	// Call on the custom parser func
+	data, err := parserFunc(value)
+	if err != nil {
+		return fmt.Errorf("Custom parser error: %v", err)
+	}
+
+	// Set the field to the data returned by the customer parser func
+	rv := reflect.ValueOf(data)
+	field.Set(rv)
+
+	return nil
+}
+
+// handleCustomSlice sets a slice from its elements, parsed one by one with the
+// custom parser of the element type.
+func handleCustomSlice(field reflect.Value, data []string, parserFunc ParserFunc) error {
+	slice := reflect.MakeSlice(field.Type(), len(data), len(data))
+	for i, v := range data {
+		if err := handleCustom(slice.Index(i), v, parserFunc); err != nil {
+			return fmt.Errorf("Unable to parse element %d %q: %v", i, v, err)
+		}
+	}
+	field.Set(slice)
+	return nil
+}
+
+func handleJSON(field reflect.Value, value string) error {
+	ptr := reflect.New(field.Type())
+	if err := json.Unmarshal([]byte(value), ptr.Interface()); err != nil {
+		return err
+	}
+	field.Set(ptr.Elem())
+	return nil
+}
+
+// handlePtr allocates a new value, parses into it and points the field to it.
+func handlePtr(field reflect.Value, refType reflect.StructField, value string, funcMap CustomParsers, fieldFuncs StructFieldParsers, bools map[string]bool) error {
+	ptr := reflect.New(field.Type().Elem())
+	if err := set(ptr.Elem(), refType, value, funcMap, fieldFuncs, bools); err != nil {
+		return err
+	}
+	field.Set(ptr)
+	return nil
+}
+
+// handleEnvSetter calls SetEnv if a pointer to the field implements
+// EnvSetter, it reports whether it did.
+func handleEnvSetter(field reflect.Value, value string) (bool, error) {
+	if field.CanAddr() && field.Addr().Type().Implements(envSetterType) {
+		return true, field.Addr().Interface().(EnvSetter).SetEnv(value)
+	}
+	return false, nil
+}
+
+// handleTextUnmarshaler calls UnmarshalText if a pointer to the field
+// implements encoding.TextUnmarshaler, it reports whether it did.
+func handleTextUnmarshaler(field reflect.Value, value string) (bool, error) {
+	if field.CanAddr() && field.Addr().Type().Implements(textUnmarshalerType) {
+		return true, field.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(value))
+	}
+	return false, nil
+}
+
+func handleTime(field reflect.Value, refType reflect.StructField, value string) error {
+	layout := refType.Tag.Get("envLayout")
+	if layout == "" {
+		layout = time.RFC3339
+	}
+
+	t, err := parseTime(layout, value)
+	if err != nil {
+		return fmt.Errorf("Unable to parse time using layout %q: %v", layout, err)
+	}
+	field.Set(reflect.ValueOf(t))
+	return nil
+}
+
+// parseTime parses value with layout, which can also be "unix" or "unixmilli"
+// for a number of seconds or milliseconds since the Unix epoch, in UTC.
+func parseTime(layout, value string) (time.Time, error) {
+	switch layout {
+	case "unix", "unixmilli":
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if layout == "unixmilli" {
+			return time.Unix(n/1000, n%1000*int64(time.Millisecond)).UTC(), nil
+		}
+		return time.Unix(n, 0).UTC(), nil
+	}
+	return time.Parse(layout, value)
+}
+
+// parseFloat parses value as a float. With percent, a value ending with % is
+// divided by 100, e.g. "75%" is 0.75.
+func parseFloat(value string, bitSize int, percent bool) (float64, error) {
+	if percent && strings.HasSuffix(value, "%") {
+		v, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), bitSize)
+		if err != nil {
+			return 0, err
+		}
+		return v / 100, nil
+	}
+	return strconv.ParseFloat(value, bitSize)
+}
+
+// isSQLNull reports whether t is one of the Null types of database/sql, like
+// sql.NullString, which hold a value and a Valid flag.
+func isSQLNull(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct && t.PkgPath() == "database/sql" && strings.HasPrefix(t.Name(), "Null") &&
+		t.NumField() == 2 && t.Field(1).Name == "Valid" && t.Field(1).Type.Kind() == reflect.Bool
+}
+
+// isNumeric reports whether t is an integer, float or complex type, including
+// time.Duration, whose values are never padded on purpose.
+func isNumeric(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
+		return true
+	}
+	return false
+}
+
+// intBase returns the base integers are written in for the field, as set by
+// its envBase tag: 0 to detect it from the 0x, 0o or 0b prefix of the value,
+// or 2 to 36. It defaults to 10.
+func intBase(refType reflect.StructField) (int, error) {
+	tag, ok := refType.Tag.Lookup("envBase")
+	if !ok {
+		return 10, nil
+	}
+	base, err := strconv.Atoi(tag)
+	if err != nil || base == 1 || base < 0 || base > 36 {
+		return 0, fmt.Errorf("Invalid envBase %q, expected 0 or 2 to 36", tag)
+	}
+	return base, nil
+}
+
+func parseInt(value string, refType reflect.StructField, bits int) (int64, error) {
+	base, err := intBase(refType)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(value, base, bits)
+}
+
+func parseUint(value string, refType reflect.StructField, bits int) (uint64, error) {
+	base, err := intBase(refType)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(value, base, bits)
+}
+
+// isSlicePtr reports whether t is a pointer to a slice.
+func isSlicePtr(t reflect.Type) bool {
+	return t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.Slice
+}
+
+// isRune reports whether the field is a rune, or a pointer to a rune, tagged
+// with envRune to be read as a single character.
+func isRune(field reflect.StructField) bool {
+	if field.Tag.Get("envRune") != "true" {
+		return false
+	}
+	t := field.Type
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Int32
+}
+
+func handleRune(field reflect.Value, value string) error {
+	if n := utf8.RuneCountInString(value); n != 1 {
+		return fmt.Errorf("expected exactly one character, got %d", n)
+	}
+	r, _ := utf8.DecodeRuneInString(value)
+	field.SetInt(int64(r))
+	return nil
+}
+
+// byteUnits are the size suffixes accepted by envBytes, in lower case.
+var byteUnits = map[string]uint64{
+	"":    1,
+	"b":   1,
+	"kb":  1000,
+	"mb":  1000 * 1000,
+	"gb":  1000 * 1000 * 1000,
+	"tb":  1000 * 1000 * 1000 * 1000,
+	"kib": 1 << 10,
+	"mib": 1 << 20,
+	"gib": 1 << 30,
+	"tib": 1 << 40,
+}
+
+// handleByteSize sets an integer field from a size such as "10MB". It reports
+// false if the field is not an integer.
+func handleByteSize(field reflect.Value, value string) (bool, error) {
+	switch field.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := parseByteSize(value)
+		if err != nil {
+			return true, err
+		}
+		if n > 1<<63-1 || field.OverflowInt(int64(n)) {
+			return true, fmt.Errorf("Size %q overflows %s", value, field.Type())
+		}
+		field.SetInt(int64(n))
+		return true, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := parseByteSize(value)
+		if err != nil {
+			return true, err
+		}
+		if field.OverflowUint(n) {
+			return true, fmt.Errorf("Size %q overflows %s", value, field.Type())
+		}
+		field.SetUint(n)
+		return true, nil
+	}
+	return false, nil
+}
+
+// parseByteSize parses a number of bytes followed by an optional SI (KB, MB,
+// ...) or IEC (KiB, MiB, ...) unit, in any case.
+func parseByteSize(value string) (uint64, error) {
+	i := 0
+	for i < len(value) && value[i] >= '0' && value[i] <= '9' {
+		i++
+	}
+	unit, ok := byteUnits[strings.ToLower(strings.TrimSpace(value[i:]))]
+	if !ok {
+		return 0, fmt.Errorf("Unknown size unit in %q", value)
+	}
+	n, err := strconv.ParseUint(value[:i], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if n > (1<<64-1)/unit {
+		return 0, fmt.Errorf("Size %q overflows uint64", value)
+	}
+	return n * unit, nil
+}
+
+func handleBigInt(field reflect.Value, value string) error {
+	n, err := parseBigInt(value)
+	if err != nil {
+		return err
+	}
+	field.Set(reflect.ValueOf(n).Elem())
+	return nil
+}
+
+func handleBigFloat(field reflect.Value, value string) error {
+	f, err := parseBigFloat(value)
+	if err != nil {
+		return err
+	}
+	field.Set(reflect.ValueOf(f).Elem())
+	return nil
+}
+
+func parseBigInt(value string) (*big.Int, error) {
+	n, ok := new(big.Int).SetString(value, 10)
+	if !ok {
+		return nil, fmt.Errorf("Unable to parse %q as big.Int", value)
+	}
+	return n, nil
+}
+
+// parseBigFloat parses value with a precision of 4 bits per character, enough
+// to hold all its digits, and at least the 64 bits of a float64 mantissa.
+func parseBigFloat(value string) (*big.Float, error) {
+	prec := uint(4 * len(value))
+	if prec < 64 {
+		prec = 64
+	}
+	f, _, err := big.ParseFloat(value, 0, prec, big.ToNearestEven)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse %q as big.Float", value)
+	}
+	return f, nil
+}
+
+func handleIP(field reflect.Value, value string) error {
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return fmt.Errorf("Unable to parse %q as IP address", value)
+	}
+	field.Set(reflect.ValueOf(ip))
+	return nil
+}
+
+func handleMAC(field reflect.Value, value string) error {
+	mac, err := net.ParseMAC(value)
+	if err != nil {
+		return err
+	}
+	field.Set(reflect.ValueOf(mac))
+	return nil
+}
+
+func handleIPNet(field reflect.Value, value string) error {
+	_, ipNet, err := net.ParseCIDR(value)
+	if err != nil {
+		return err
+	}
+	field.Set(reflect.ValueOf(ipNet))
+	return nil
+}
+
+// isQuery tells whether the field holds a query string, either as an
+// `url.Values` or as a `map[string][]string` tagged with `envQuery:"true"`.
+func isQuery(refType reflect.StructField) bool {
+	t := refType.Type
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t == urlValuesType || t == mapOfStringSlices && refType.Tag.Get("envQuery") == "true"
+}
+
+func handleQuery(field reflect.Value, value string) error {
+	values, err := url.ParseQuery(value)
+	if err != nil {
+		return err
+	}
+	field.Set(reflect.ValueOf(values).Convert(field.Type()))
+	return nil
 }
 
-func doParse(ref reflect.Value, funcMap CustomParsers, prefix string) error {
-	refType := ref.Type()
-	var errorList []string
+// parseFileMode parses an octal permission like 0644, with an optional 0o
+// prefix.
+func parseFileMode(value string) (os.FileMode, error) {
+	digits := strings.TrimPrefix(strings.TrimPrefix(value, "0o"), "0O")
+	mode, err := strconv.ParseUint(digits, 8, 32)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid file mode %q, expected an octal number like 0644", value)
+	}
+	return os.FileMode(mode), nil
+}
 
-	for i := 0; i < refType.NumField(); i++ {
-		if reflect.Ptr == ref.Field(i).Kind() && !ref.Field(i).IsNil() && ref.Field(i).CanSet() {
-			err := PrefixedParse(ref.Field(i).Interface(), prefix)
-			if nil != err {
-				return err
-			}
-			continue
-		}
-		value, err := get(refType.Field(i), prefix)
-		if err != nil {
-			errorList = append(errorList, err.Error())
-			continue
-		}
-		if value == "" {
-			continue
-		}
-		if err := set(ref.Field(i), refType.Field(i), value, funcMap); err != nil {
-			errorList = append(errorList, err.Error())
-			continue
-		}
+func handleURL(field reflect.Value, value string) error {
+	u, err := url.Parse(value)
+	if err != nil {
+		return err
 	}
-	if len(errorList) == 0 {
-		return nil
+	if field.Kind() == reflect.Ptr {
+		field.Set(reflect.ValueOf(u))
+	} else {
+		field.Set(reflect.ValueOf(*u))
 	}
-	return errors.New(strings.Join(errorList, ". "))
+	return nil
 }
 
-func get(field reflect.StructField, prefix string) (string, error) {
+// handleBytes decodes byte slices according to the envEncoding tag, which can
+// be "base64" or "hex", it defaults to the raw bytes of value.
+func handleBytes(field reflect.Value, refType reflect.StructField, value string) error {
 	var (
-		val string
-		err error
+		data []byte
+		err  error
 	)
 
-	key, opts := parseKeyForOption(field.Tag.Get("env"))
-	key = prefix + key
-
-	defaultValue := field.Tag.Get("envDefault")
-	val = getOr(key, defaultValue)
-
-	if len(opts) > 0 {
-		for _, opt := range opts {
-			// The only option supported is "required".
-			switch opt {
-			case "":
-				break
-			case "required":
-				val, err = getRequired(key)
-			default:
-				err = errors.New("Env tag option " + opt + " not supported.")
-			}
-		}
+	switch encoding := refType.Tag.Get("envEncoding"); encoding {
+	case "":
+		data = []byte(value)
+	case "base64":
+		data, err = base64.StdEncoding.DecodeString(value)
+	case "hex":
+		data, err = hex.DecodeString(value)
+	default:
+		err = errors.New("Encoding " + encoding + " not supported")
 	}
-
-	return val, err
+	if err != nil {
+		return err
+	}
+	field.Set(reflect.ValueOf(data).Convert(field.Type()))
+	return nil
 }
 
-// split the env tag's key into the expected key and desired option, if any.
-func parseKeyForOption(key string) (string, []string) {
-	opts := strings.Split(key, ",")
-	return opts[0], opts[1:]
-}
+func handleSlice(field reflect.Value, refType reflect.StructField, value string, funcMap CustomParsers, fieldFuncs StructFieldParsers, bools map[string]bool) error {
+	base, err := intBase(refType)
+	if err != nil {
+		return err
+	}
+	separator := refType.Tag.Get("envSeparator")
+	if separator == "" {
+		separator = ","
+	}
 
-func getRequired(key string) (string, error) {
-	if value, ok := os.LookupEnv(key); ok {
-		return value, nil
+	splitData := splitLines(value, separator)
+	if refType.Tag.Get("envCSV") == "true" {
+		if splitData, err = splitCSV(value, separator); err != nil {
+			return err
+		}
+	}
+	if refType.Tag.Get("envTrim") == "true" || isNumeric(field.Type().Elem()) {
+		for i := range splitData {
+			splitData[i] = strings.TrimSpace(splitData[i])
+		}
+	}
+	if isNumeric(field.Type().Elem()) || refType.Tag.Get("envOmitEmpty") == "true" {
+		splitData = omitEmpty(splitData)
 	}
-	// We do not use fmt.Errorf to avoid another import.
-	return "", errors.New("Required environment variable " + key + " is not set")
-}
 
-func getOr(key, defaultValue string) string {
-	value, ok := os.LookupEnv(key)
-	if ok {
-		return value
+	elemType := field.Type().Elem()
+	if parserFunc, ok := fieldFuncs[elemType]; ok {
+		return handleCustomSlice(field, splitData, func(v string) (interface{}, error) {
+			return parserFunc(v, refType)
+		})
+	}
+	if parserFunc, ok := funcMap[elemType]; ok {
+		return handleCustomSlice(field, splitData, parserFunc)
 	}
-	return defaultValue
-}
 
-func set(field reflect.Value, refType reflect.StructField, value string, funcMap CustomParsers) error {
-	switch field.Kind() {
-	case reflect.Slice:
-		separator := refType.Tag.Get("envSeparator")
-		return handleSlice(field, value, separator)
-	case reflect.String:
-		field.SetString(value)
-	case reflect.Bool:
-		bvalue, err := strconv.ParseBool(value)
+	switch field.Type() {
+	case sliceOfStrings:
+		field.Set(reflect.ValueOf(splitData))
+	case sliceOfInts:
+		intData, err := parseInts(splitData, base)
 		if err != nil {
 			return err
 		}
-		field.SetBool(bvalue)
-	case reflect.Int:
-		intValue, err := strconv.ParseInt(value, 10, 32)
+		field.Set(reflect.ValueOf(intData))
+	case sliceOfInt64s:
+		int64Data, err := parseInt64s(splitData, base)
 		if err != nil {
 			return err
 		}
-		field.SetInt(intValue)
-	case reflect.Uint:
-		uintValue, err := strconv.ParseUint(value, 10, 32)
+		field.Set(reflect.ValueOf(int64Data))
+	case sliceOfUint64s:
+		uint64Data, err := parseUint64s(splitData, base)
 		if err != nil {
 			return err
 		}
-		field.SetUint(uintValue)
-	case reflect.Float32:
-		v, err := strconv.ParseFloat(value, 32)
+		field.Set(reflect.ValueOf(uint64Data))
+	case sliceOfFloat32s:
+		data, err := parseFloat32s(splitData)
 		if err != nil {
 			return err
 		}
-		field.SetFloat(v)
-	case reflect.Float64:
-		v, err := strconv.ParseFloat(value, 64)
+		field.Set(reflect.ValueOf(data))
+	case sliceOfFloat64s:
+		data, err := parseFloat64s(splitData)
 		if err != nil {
 			return err
 		}
-		field.Set(reflect.ValueOf(v))
-	case reflect.Int64:
-		if refType.Type.String() == "time.Duration" {
-			dValue, err := time.ParseDuration(value)
+		field.Set(reflect.ValueOf(data))
+	case sliceOfBools:
+		boolData, err := parseBools(splitData, bools)
+		if err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(boolData))
+	case sliceOfDurations:
+		durationData, err := parseDurations(splitData, refType.Tag.Get("envDurationUnit"))
+		if err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(durationData))
+	case sliceOfIPs:
+		ipData, err := parseIPs(splitData)
+		if err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(ipData))
+	case sliceOfComplex:
+		data, err := parseComplexes(splitData)
+		if err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(data))
+	case sliceOfTimes:
+		data, err := parseTimes(splitData, refType.Tag.Get("envLayout"))
+		if err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(data))
+	case sliceOfMACs:
+		data := make([]net.HardwareAddr, 0, len(splitData))
+		for _, v := range splitData {
+			mac, err := net.ParseMAC(v)
 			if err != nil {
 				return err
 			}
-			field.Set(reflect.ValueOf(dValue))
-		} else {
-			intValue, err := strconv.ParseInt(value, 10, 64)
+			data = append(data, mac)
+		}
+		field.Set(reflect.ValueOf(data))
+	case sliceOfRegexps:
+		data := make([]*regexp.Regexp, 0, len(splitData))
+		for _, v := range splitData {
+			re, err := regexp.Compile(v)
 			if err != nil {
 				return err
 			}
-			field.SetInt(intValue)
+			data = append(data, re)
 		}
-	case reflect.Uint64:
-		uintValue, err := strconv.ParseUint(value, 10, 64)
+		field.Set(reflect.ValueOf(data))
+	case sliceOfBigInts:
+		data := make([]*big.Int, 0, len(splitData))
+		for _, v := range splitData {
+			n, err := parseBigInt(v)
+			if err != nil {
+				return err
+			}
+			data = append(data, n)
+		}
+		field.Set(reflect.ValueOf(data))
+	case sliceOfBigFloats:
+		data := make([]*big.Float, 0, len(splitData))
+		for _, v := range splitData {
+			f, err := parseBigFloat(v)
+			if err != nil {
+				return err
+			}
+			data = append(data, f)
+		}
+		field.Set(reflect.ValueOf(data))
+	case sliceOfFileModes:
+		data := make([]os.FileMode, 0, len(splitData))
+		for _, v := range splitData {
+			mode, err := parseFileMode(v)
+			if err != nil {
+				return err
+			}
+			data = append(data, mode)
+		}
+		field.Set(reflect.ValueOf(data))
+	default:
+		data, err := parseSizedInts(field.Type(), splitData, base)
 		if err != nil {
 			return err
 		}
-		field.SetUint(uintValue)
-	case reflect.Struct:
-		return handleStruct(field, refType, value, funcMap)
-	default:
-		return ErrUnsupportedType
+		field.Set(data)
 	}
 	return nil
 }
 
-func handleStruct(field reflect.Value, refType reflect.StructField, value string, funcMap CustomParsers) error {
-	// Does the custom parser func map contain this type?
-	parserFunc, ok := funcMap[field.Type()]
-	if !ok {
-		// Map does not contain a custom parser for this type
-		return ErrUnsupportedType
+// handleArray parses value as a slice of the same element type and copies it
+// into the array, which must be filled exactly.
+func handleArray(field reflect.Value, refType reflect.StructField, value string, funcMap CustomParsers, fieldFuncs StructFieldParsers, bools map[string]bool) error {
+	data := reflect.New(reflect.SliceOf(field.Type().Elem())).Elem()
+	if err := set(data, refType, value, funcMap, fieldFuncs, bools); err != nil {
+		return err
 	}
+	if data.Len() != field.Len() {
+		return fmt.Errorf("expected %d elements, got %d", field.Len(), data.Len())
+	}
+	reflect.Copy(field, data)
+	return nil
+}
 
-	// Call on the custom parser func
-	data, err := parserFunc(value)
-	if err != nil {
-		return fmt.Errorf("Custom parser error: %v", err)
+// omitEmpty removes the empty strings of data, in place.
+func omitEmpty(data []string) []string {
+	ret := data[:0]
+	for _, v := range data {
+		if v != "" {
+			ret = append(ret, v)
+		}
 	}
+	return ret
+}
 
-	// Set the field to the data returned by the customer parser func
-	rv := reflect.ValueOf(data)
-	field.Set(rv)
+// splitCSV splits value with the rules of encoding/csv, so that elements can
+// be quoted to hold the separator, which must be a single character.
+func splitCSV(value, separator string) ([]string, error) {
+	comma, size := utf8.DecodeRuneInString(separator)
+	if size != len(separator) {
+		return nil, fmt.Errorf("envCSV needs a single character separator, got %q", separator)
+	}
 
-	return nil
+	r := csv.NewReader(strings.NewReader(value))
+	r.Comma = comma
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) != 1 {
+		return nil, fmt.Errorf("expected a single CSV line, got %d", len(records))
+	}
+	return records[0], nil
+}
+
+// splitLines splits value by separator, dropping the carriage return ending
+// the elements when the separator is a newline, so that both "\n" and "\r\n"
+// line endings work.
+func splitLines(value, separator string) []string {
+	data := strings.Split(value, separator)
+	if separator == "\n" {
+		for i := range data {
+			data[i] = strings.TrimSuffix(data[i], "\r")
+		}
+	}
+	return data
 }
 
-func handleSlice(field reflect.Value, value, separator string) error {
+// handleMap parses the entries of value, split by separator, or following the
+// CSV rules if quoted is set, so that entries can hold the separator.
+func handleMap(field reflect.Value, value, separator, kvSeparator string, base int, quoted bool) error {
 	if separator == "" {
 		separator = ","
 	}
+	if kvSeparator == "" {
+		kvSeparator = ":"
+	}
 
-	splitData := strings.Split(value, separator)
+	splitData := splitLines(value, separator)
+	if quoted {
+		var err error
+		if splitData, err = splitCSV(value, separator); err != nil {
+			return err
+		}
+	}
 
 	switch field.Type() {
-	case sliceOfStrings:
-		field.Set(reflect.ValueOf(splitData))
-	case sliceOfInts:
-		intData, err := parseInts(splitData)
+	case mapOfStrings:
+		data, err := parseStringMap(splitData, kvSeparator)
 		if err != nil {
 			return err
 		}
-		field.Set(reflect.ValueOf(intData))
-	case sliceOfInt64s:
-		int64Data, err := parseInt64s(splitData)
+		field.Set(reflect.ValueOf(data))
+	case mapOfInts:
+		data, err := parseIntMap(splitData, kvSeparator, base)
 		if err != nil {
 			return err
 		}
-		field.Set(reflect.ValueOf(int64Data))
-	case sliceOfUint64s:
-		uint64Data, err := parseUint64s(splitData)
+		field.Set(reflect.ValueOf(data))
+	case mapOfStringSlices:
+		data, err := parseStringSliceMap(splitData, kvSeparator)
 		if err != nil {
 			return err
 		}
-		field.Set(reflect.ValueOf(uint64Data))
-	case sliceOfFloat32s:
-		data, err := parseFloat32s(splitData)
+		field.Set(reflect.ValueOf(data))
+	default:
+		return ErrUnsupportedType
+	}
+	return nil
+}
+
+func splitPair(pair, kvSeparator string) (string, string, error) {
+	kv := strings.SplitN(pair, kvSeparator, 2)
+	if len(kv) != 2 {
+		return "", "", fmt.Errorf("Invalid map entry %q: missing separator %q", pair, kvSeparator)
+	}
+	if kv[0] == "" {
+		return "", "", fmt.Errorf("Invalid map entry %q: empty key", pair)
+	}
+	return kv[0], kv[1], nil
+}
+
+func parseStringMap(data []string, kvSeparator string) (map[string]string, error) {
+	stringMap := make(map[string]string, len(data))
+
+	for _, pair := range data {
+		k, v, err := splitPair(pair, kvSeparator)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		field.Set(reflect.ValueOf(data))
-	case sliceOfFloat64s:
-		data, err := parseFloat64s(splitData)
+		stringMap[k] = v
+	}
+	return stringMap, nil
+}
+
+// parseStringSliceMap is like parseStringMap, but the values of repeated keys
+// accumulate in order.
+func parseStringSliceMap(data []string, kvSeparator string) (map[string][]string, error) {
+	sliceMap := make(map[string][]string, len(data))
+
+	for _, pair := range data {
+		k, v, err := splitPair(pair, kvSeparator)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		field.Set(reflect.ValueOf(data))
-	case sliceOfBools:
-		boolData, err := parseBools(splitData)
+		sliceMap[k] = append(sliceMap[k], v)
+	}
+	return sliceMap, nil
+}
+
+func parseIntMap(data []string, kvSeparator string, base int) (map[string]int, error) {
+	intMap := make(map[string]int, len(data))
+
+	for _, pair := range data {
+		k, v, err := splitPair(pair, kvSeparator)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		field.Set(reflect.ValueOf(boolData))
-	case sliceOfDurations:
-		durationData, err := parseDurations(splitData)
+		intValue, err := strconv.ParseInt(v, base, 32)
 		if err != nil {
-			return err
+			return nil, fmt.Errorf("Invalid map entry %q: %v", pair, err)
 		}
-		field.Set(reflect.ValueOf(durationData))
-	default:
-		return ErrUnsupportedSliceType
+		intMap[k] = int(intValue)
 	}
-	return nil
+	return intMap, nil
 }
 
-func parseInts(data []string) ([]int, error) {
+func parseInts(data []string, base int) ([]int, error) {
 	intSlice := make([]int, 0, len(data))
 
 	for _, v := range data {
-		intValue, err := strconv.ParseInt(v, 10, 32)
+		intValue, err := strconv.ParseInt(v, base, 32)
 		if err != nil {
 			return nil, err
 		}
@@ -313,11 +2570,11 @@ func parseInts(data []string) ([]int, error) {
 	return intSlice, nil
 }
 
-func parseInt64s(data []string) ([]int64, error) {
+func parseInt64s(data []string, base int) ([]int64, error) {
 	intSlice := make([]int64, 0, len(data))
 
 	for _, v := range data {
-		intValue, err := strconv.ParseInt(v, 10, 64)
+		intValue, err := strconv.ParseInt(v, base, 64)
 		if err != nil {
 			return nil, err
 		}
@@ -326,11 +2583,11 @@ func parseInt64s(data []string) ([]int64, error) {
 	return intSlice, nil
 }
 
-func parseUint64s(data []string) ([]uint64, error) {
+func parseUint64s(data []string, base int) ([]uint64, error) {
 	var uintSlice []uint64
 
 	for _, v := range data {
-		uintValue, err := strconv.ParseUint(v, 10, 64)
+		uintValue, err := strconv.ParseUint(v, base, 64)
 		if err != nil {
 			return nil, err
 		}
@@ -365,11 +2622,22 @@ func parseFloat64s(data []string) ([]float64, error) {
 	return float64Slice, nil
 }
 
-func parseBools(data []string) ([]bool, error) {
+// parseBool looks value up in words, regardless of case, and otherwise parses
+// it with strconv.ParseBool.
+func parseBool(value string, words map[string]bool) (bool, error) {
+	for word, b := range words {
+		if strings.EqualFold(word, value) {
+			return b, nil
+		}
+	}
+	return strconv.ParseBool(value)
+}
+
+func parseBools(data []string, words map[string]bool) ([]bool, error) {
 	boolSlice := make([]bool, 0, len(data))
 
 	for _, v := range data {
-		bvalue, err := strconv.ParseBool(v)
+		bvalue, err := parseBool(v, words)
 		if err != nil {
 			return nil, err
 		}
@@ -379,11 +2647,22 @@ func parseBools(data []string) ([]bool, error) {
 	return boolSlice, nil
 }
 
-func parseDurations(data []string) ([]time.Duration, error) {
+// parseDuration parses value as a time.Duration. If unit is set, a bare number
+// is read in this unit, e.g. "30" with unit "s" is 30 seconds.
+func parseDuration(value, unit string) (time.Duration, error) {
+	if unit != "" {
+		if _, err := strconv.ParseFloat(value, 64); err == nil {
+			value += unit
+		}
+	}
+	return time.ParseDuration(value)
+}
+
+func parseDurations(data []string, unit string) ([]time.Duration, error) {
 	durationSlice := make([]time.Duration, 0, len(data))
 
 	for _, v := range data {
-		dvalue, err := time.ParseDuration(v)
+		dvalue, err := parseDuration(v, unit)
 		if err != nil {
 			return nil, err
 		}
@@ -392,3 +2671,82 @@ func parseDurations(data []string) ([]time.Duration, error) {
 	}
 	return durationSlice, nil
 }
+
+// parseSizedInts parses slices of the sized integer types, like []int8 or
+// []uint16. []uint8 is left out since it is usually meant as []byte.
+func parseSizedInts(sliceType reflect.Type, data []string, base int) (reflect.Value, error) {
+	elemType := sliceType.Elem()
+	signed := false
+	switch elemType.Kind() {
+	case reflect.Int8, reflect.Int16, reflect.Int32:
+		signed = true
+	case reflect.Uint16, reflect.Uint32:
+	default:
+		// checked first, so that an empty slice of an unsupported type is
+		// an error too
+		return reflect.Value{}, ErrUnsupportedSliceType
+	}
+
+	ret := reflect.MakeSlice(sliceType, 0, len(data))
+	for _, v := range data {
+		elem := reflect.New(elemType).Elem()
+		if signed {
+			intValue, err := strconv.ParseInt(v, base, elemType.Bits())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			elem.SetInt(intValue)
+		} else {
+			uintValue, err := strconv.ParseUint(v, base, elemType.Bits())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			elem.SetUint(uintValue)
+		}
+		ret = reflect.Append(ret, elem)
+	}
+	return ret, nil
+}
+
+func parseComplexes(data []string) ([]complex128, error) {
+	complexSlice := make([]complex128, 0, len(data))
+
+	for _, v := range data {
+		data, err := strconv.ParseComplex(v, 128)
+		if err != nil {
+			return nil, err
+		}
+		complexSlice = append(complexSlice, data)
+	}
+	return complexSlice, nil
+}
+
+func parseTimes(data []string, layout string) ([]time.Time, error) {
+	if layout == "" {
+		layout = time.RFC3339
+	}
+	timeSlice := make([]time.Time, 0, len(data))
+
+	for i, v := range data {
+		t, err := parseTime(layout, v)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to parse element %d %q using layout %q: %v", i, v, layout, err)
+		}
+		timeSlice = append(timeSlice, t)
+	}
+	return timeSlice, nil
+}
+
+func parseIPs(data []string) ([]net.IP, error) {
+	ipSlice := make([]net.IP, 0, len(data))
+
+	for _, v := range data {
+		ip := net.ParseIP(v)
+		if ip == nil {
+			return nil, fmt.Errorf("Unable to parse %q as IP address", v)
+		}
+
+		ipSlice = append(ipSlice, ip)
+	}
+	return ipSlice, nil
+}
@@ -1,11 +1,21 @@
 package env
 
 import (
+	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -85,6 +95,7 @@ func TestEnv(t *testing.T) {
 			t.Run("ParseEnv", wrap(testParsesEnv, c))
 			t.Run("ParseEnvInner", wrap(testParsesEnvInner, c))
 			t.Run("ParsesEnvInnerNil", wrap(testParsesEnvInnerNil, c))
+			t.Run("ParsesEnvInnerInit", wrap(testParsesEnvInnerInit, c))
 			t.Run("ParseEnvInnerInvalid", wrap(testParsesEnvInnerInvalid, c))
 			t.Run("EmptyVars", wrap(testEmptyVars, c))
 			t.Run("PassAnInvalidPtr", wrap(testPassAnInvalidPtr, c))
@@ -104,18 +115,89 @@ func TestEnv(t *testing.T) {
 			t.Run("InvalidDuration", wrap(testInvalidDuration, c))
 			t.Run("InvalidDurations", wrap(testInvalidDurations, c))
 			t.Run("ParsesDefaultconfig", wrap(testParsesDefaultConfig, c))
+			t.Run("ParsesSliceDefaults", wrap(testParsesSliceDefaults, c))
 			t.Run("ParseStructWithoutEnvTag", wrap(testParseStructWithoutEnvTag, c))
 			t.Run("ParseStructWithInvalidFieldKind", wrap(testParseStructWithInvalidFieldKind, c))
 			t.Run("UnsupportedSliceType", wrap(testUnsupportedSliceType, c))
 			t.Run("BadSeparator", wrap(testBadSeparator, c))
 			t.Run("NoErrorRequiredSet", wrap(testNoErrorRequiredSet, c))
 			t.Run("ErrorRequiredNotSet", wrap(testErrorRequiredNotSet, c))
+			t.Run("ErrorNotEmpty", wrap(testErrorNotEmpty, c))
+			t.Run("OneOf", wrap(testOneOf, c))
+			t.Run("Match", wrap(testMatch, c))
 			t.Run("CustomParser", wrap(testCustomParser, c))
+			t.Run("CustomParserSlices", wrap(testCustomParserSlices, c))
+			t.Run("TextUnmarshaler", wrap(testTextUnmarshaler, c))
+			t.Run("ParsesJSON", wrap(testParsesJSON, c))
+			t.Run("ParsesPointers", wrap(testParsesPointers, c))
+			t.Run("ParsesSlicePointers", wrap(testParsesSlicePointers, c))
+			t.Run("ParsesSizedInts", wrap(testParsesSizedInts, c))
+			t.Run("ParsesIntBase", wrap(testParsesIntBase, c))
+			t.Run("InvalidIntBase", wrap(testInvalidIntBase, c))
+			t.Run("ParsesFileMode", wrap(testParsesFileMode, c))
+			t.Run("ParsesLocation", wrap(testParsesLocation, c))
+			t.Run("ParsesComplex", wrap(testParsesComplex, c))
+			t.Run("Bounds", wrap(testBounds, c))
+			t.Run("DurationBounds", wrap(testDurationBounds, c))
+			t.Run("ParsesBytes", wrap(testParsesBytes, c))
 			t.Run("ParseWithFuncsNoPtr", wrap(testParseWithFuncsNoPtr, c))
 			t.Run("ParseWithFuncsInvalidType", wrap(testParseWithFuncsInvalidType, c))
 			t.Run("CustomParserError", wrap(testCustomParserError, c))
 			t.Run("UnsupportedStructType", wrap(testUnsupportedStructType, c))
 			t.Run("EmptyOption", wrap(testEmptyOption, c))
+			t.Run("ParsesTime", wrap(testParsesTime, c))
+			t.Run("ParsesUnixTime", wrap(testParsesUnixTime, c))
+			t.Run("InvalidTime", wrap(testInvalidTime, c))
+			t.Run("ParsesNet", wrap(testParsesNet, c))
+			t.Run("InvalidNet", wrap(testInvalidNet, c))
+			t.Run("ParsesURL", wrap(testParsesURL, c))
+			t.Run("ParseErrorDetails", wrap(testParseErrorDetails, c))
+			t.Run("ParsesMaps", wrap(testParsesMaps, c))
+			t.Run("InvalidMaps", wrap(testInvalidMaps, c))
+			t.Run("ParsesStructSlice", wrap(testParsesStructSlice, c))
+			t.Run("ParsesStructMap", wrap(testParsesStructMap, c))
+			t.Run("ParsesNestedStructs", wrap(testParsesNestedStructs, c))
+			t.Run("ParsesNestedPrefix", wrap(testParsesNestedPrefix, c))
+			t.Run("ParsesArrays", wrap(testParsesArrays, c))
+			t.Run("TrimsNumericSlices", wrap(testTrimsNumericSlices, c))
+			t.Run("ParsesPresence", wrap(testParsesPresence, c))
+			t.Run("ParsesPercent", wrap(testParsesPercent, c))
+			t.Run("ExpandsDefaults", wrap(testExpandsDefaults, c))
+			t.Run("SkipsDashTag", wrap(testSkipsDashTag, c))
+			t.Run("ParsesByteSizes", wrap(testParsesByteSizes, c))
+			t.Run("InvalidByteSizes", wrap(testInvalidByteSizes, c))
+			t.Run("InvalidPercent", wrap(testInvalidPercent, c))
+			t.Run("ParsesMAC", wrap(testParsesMAC, c))
+			t.Run("ParsesRegexp", wrap(testParsesRegexp, c))
+			t.Run("ParsesDefaultOnEmpty", wrap(testParsesDefaultOnEmpty, c))
+			t.Run("ParsesOmitEmpty", wrap(testParsesOmitEmpty, c))
+			t.Run("ParsesMultiCharSeparators", wrap(testParsesMultiCharSeparators, c))
+			t.Run("ParsesQuotedMaps", wrap(testParsesQuotedMaps, c))
+			t.Run("ParsesLines", wrap(testParsesLines, c))
+			t.Run("InvalidSeparators", wrap(testInvalidSeparators, c))
+			t.Run("ParsesSQLNull", wrap(testParsesSQLNull, c))
+			t.Run("InvalidSQLNull", wrap(testInvalidSQLNull, c))
+			t.Run("ParsesEnvSetter", wrap(testParsesEnvSetter, c))
+			t.Run("ParsesCSV", wrap(testParsesCSV, c))
+			t.Run("InvalidCSV", wrap(testInvalidCSV, c))
+			t.Run("ParsesRunes", wrap(testParsesRunes, c))
+			t.Run("InvalidRunes", wrap(testInvalidRunes, c))
+			t.Run("ParsesTransform", wrap(testParsesTransform, c))
+			t.Run("InvalidTransform", wrap(testInvalidTransform, c))
+			t.Run("ParsesTimes", wrap(testParsesTimes, c))
+			t.Run("InvalidTimes", wrap(testInvalidTimes, c))
+			t.Run("ParsesBigNumbers", wrap(testParsesBigNumbers, c))
+			t.Run("InvalidBigNumbers", wrap(testInvalidBigNumbers, c))
+			t.Run("ParsesDurationUnit", wrap(testParsesDurationUnit, c))
+			t.Run("InvalidDurationUnit", wrap(testInvalidDurationUnit, c))
+			t.Run("InvalidArrays", wrap(testInvalidArrays, c))
+			t.Run("ParsesFile", wrap(testParsesFile, c))
+			t.Run("ParsesExpand", wrap(testParsesExpand, c))
+			t.Run("ParsesTrim", wrap(testParsesTrim, c))
+			t.Run("ParsesAliases", wrap(testParsesAliases, c))
+			t.Run("InvalidURL", wrap(testInvalidURL, c))
+			t.Run("ParsesQuery", wrap(testParsesQuery, c))
+			t.Run("InvalidQuery", wrap(testInvalidQuery, c))
 			t.Run("ErrorOptionNotRecognized", wrap(testErrorOptionNotRecognized, c))
 		})
 	}
@@ -188,6 +270,32 @@ func testParsesEnvInnerNil(t *testing.T, a TestAgainst) {
 	assert.NoError(t, a.run(&cfg))
 }
 
+func testParsesEnvInnerInit(t *testing.T, a TestAgainst) {
+	type db struct {
+		Host string `env:"HOST"`
+		Port int    `env:"PORT" envDefault:"5432"`
+	}
+	type config struct {
+		Inner   *InnerStruct `envInit:"true"`
+		DB      *db          `envPrefix:"DB_" envInit:"true"`
+		Cache   *db          `envPrefix:"CACHE_" envInit:"true"`
+		Skipped *db          `envPrefix:"DB_"`
+	}
+
+	a.setenv("innervar", "someinnervalue")
+	a.setenv("DB_HOST", "localhost")
+	defer os.Clearenv()
+
+	cfg := &config{}
+	assert.NoError(t, a.run(cfg))
+	if assert.NotNil(t, cfg.Inner) {
+		assert.Equal(t, "someinnervalue", cfg.Inner.Inner)
+	}
+	assert.Equal(t, &db{Host: "localhost", Port: 5432}, cfg.DB)
+	assert.Nil(t, cfg.Cache)
+	assert.Nil(t, cfg.Skipped)
+}
+
 func testParsesEnvInnerInvalid(t *testing.T, a TestAgainst) {
 	a.setenv("innernum", "-547")
 	defer os.Clearenv()
@@ -350,6 +458,28 @@ func testParsesDefaultConfig(t *testing.T, a TestAgainst) {
 	assert.Equal(t, "postgres://localhost:5432/db", cfg.DatabaseURL)
 }
 
+func testParsesSliceDefaults(t *testing.T, a TestAgainst) {
+	type config struct {
+		Hosts    []string `env:"HOSTS" envDefault:"a,b,c"`
+		Numbers  []int    `env:"NUMBERS" envDefault:"1:2:3" envSeparator:":"`
+		Override []int    `env:"OVERRIDE" envDefault:"1,2,3"`
+		Invalid  []int    `env:"INVALID" envDefault:"1,x"`
+	}
+
+	a.setenv("OVERRIDE", "4,5")
+	a.setenv("INVALID", "6")
+	defer os.Clearenv()
+
+	cfg := &config{}
+	assert.NoError(t, a.run(cfg))
+	assert.Equal(t, []string{"a", "b", "c"}, cfg.Hosts)
+	assert.Equal(t, []int{1, 2, 3}, cfg.Numbers)
+	assert.Equal(t, []int{4, 5}, cfg.Override)
+
+	os.Clearenv()
+	assert.Error(t, a.run(&config{}))
+}
+
 func testParseStructWithoutEnvTag(t *testing.T, a TestAgainst) {
 	cfg := Config{}
 	assert.NoError(t, a.run(&cfg))
@@ -358,7 +488,7 @@ func testParseStructWithoutEnvTag(t *testing.T, a TestAgainst) {
 
 func testParseStructWithInvalidFieldKind(t *testing.T, a TestAgainst) {
 	type config struct {
-		WontWorkByte byte `env:"BLAH"`
+		WontWork chan int `env:"BLAH"`
 	}
 	a.setenv("BLAH", "a")
 	cfg := config{}
@@ -370,11 +500,20 @@ func testUnsupportedSliceType(t *testing.T, a TestAgainst) {
 		WontWork []map[int]int `env:"WONTWORK"`
 	}
 
+	type omitted struct {
+		WontWork []map[int]int `env:"WONTWORK" envOmitEmpty:"true"`
+	}
+
 	a.setenv("WONTWORK", "1,2,3")
 	defer os.Clearenv()
 
 	cfg := &config{}
 	assert.Error(t, a.run(cfg))
+
+	// no element left is still an unsupported type
+	a.setenv("WONTWORK", ",")
+	err := a.run(&omitted{})
+	assert.True(t, errors.Is(err, ErrUnsupportedSliceType))
 }
 
 func testBadSeparator(t *testing.T, a TestAgainst) {
@@ -411,6 +550,77 @@ func testErrorRequiredNotSet(t *testing.T, a TestAgainst) {
 	assert.Error(t, a.run(cfg))
 }
 
+func testErrorNotEmpty(t *testing.T, a TestAgainst) {
+	type config struct {
+		Token string `env:"TOKEN,notEmpty"`
+	}
+
+	cfg := &config{}
+	err := a.run(cfg)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "is not set")
+
+	a.setenv("TOKEN", "")
+	defer os.Clearenv()
+	err = a.run(cfg)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "is set but empty")
+
+	a.setenv("TOKEN", "secret")
+	assert.NoError(t, a.run(cfg))
+	assert.Equal(t, "secret", cfg.Token)
+}
+
+func testOneOf(t *testing.T, a TestAgainst) {
+	type config struct {
+		LogLevel string `env:"LOG_LEVEL,oneof=debug|info|warn|error"`
+	}
+	type defaultConfig struct {
+		LogLevel string `env:"LOG_LEVEL,oneof=debug|info" envDefault:"verbose"`
+	}
+
+	cfg := &config{}
+	assert.NoError(t, a.run(cfg))
+	assert.Error(t, a.run(&defaultConfig{}))
+
+	a.setenv("LOG_LEVEL", "warn")
+	defer os.Clearenv()
+	assert.NoError(t, a.run(cfg))
+	assert.Equal(t, "warn", cfg.LogLevel)
+
+	a.setenv("LOG_LEVEL", "verbose")
+	err := a.run(cfg)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "debug, info, warn, error")
+	assert.Contains(t, err.Error(), "verbose")
+}
+
+func testMatch(t *testing.T, a TestAgainst) {
+	type config struct {
+		APIKey string `env:"API_KEY" envMatch:"^sk-[a-z0-9]{8}$"`
+	}
+	type badConfig struct {
+		APIKey string `env:"API_KEY" envMatch:"^sk-[a-z"`
+	}
+
+	a.setenv("API_KEY", "sk-abcd1234")
+	defer os.Clearenv()
+
+	cfg := &config{}
+	assert.NoError(t, a.run(cfg))
+	assert.Equal(t, "sk-abcd1234", cfg.APIKey)
+
+	err := a.run(&badConfig{})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Invalid envMatch pattern")
+
+	a.setenv("API_KEY", "pk-abcd1234")
+	err = a.run(&config{})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "does not match")
+	assert.NotContains(t, err.Error(), "pk-abcd1234")
+}
+
 func testCustomParser(t *testing.T, a TestAgainst) {
 	type foo struct {
 		name string
@@ -435,79 +645,3185 @@ func testCustomParser(t *testing.T, a TestAgainst) {
 	assert.Equal(t, cfg.Var.name, "test")
 }
 
-func testParseWithFuncsNoPtr(t *testing.T, a TestAgainst) {
-	type foo struct{}
-	err := a.runWithFuncs(foo{}, nil)
-	assert.Error(t, err)
-	assert.Equal(t, err, ErrNotAStructPtr)
+func testCustomParserSlices(t *testing.T, a TestAgainst) {
+	type foo struct {
+		name string
+	}
+	type config struct {
+		Vars  []foo    `env:"VARS"`
+		Array [2]foo   `env:"ARRAY" envSeparator:";"`
+		Ptrs  *[]foo   `env:"PTRS"`
+		Exact []string `env:"EXACT"`
+	}
+
+	a.setenv("VARS", "a,b,,c")
+	a.setenv("ARRAY", "x;y")
+	a.setenv("PTRS", "p")
+	a.setenv("EXACT", "e")
+	defer os.Clearenv()
+
+	parsers := CustomParsers{
+		reflect.TypeOf(foo{}): func(v string) (interface{}, error) {
+			if v == "bad" {
+				return nil, errors.New("bad foo")
+			}
+			return foo{name: v}, nil
+		},
+		reflect.TypeOf([]string(nil)): func(v string) (interface{}, error) {
+			return []string{"exact " + v}, nil
+		},
+		reflect.TypeOf(""): func(v string) (interface{}, error) {
+			return "element " + v, nil
+		},
+	}
+	cfg := &config{}
+	assert.NoError(t, a.runWithFuncs(cfg, parsers))
+	assert.Equal(t, []foo{{"a"}, {"b"}, {""}, {"c"}}, cfg.Vars)
+	assert.Equal(t, [2]foo{{"x"}, {"y"}}, cfg.Array)
+	assert.Equal(t, []foo{{"p"}}, *cfg.Ptrs)
+	assert.Equal(t, []string{"exact e"}, cfg.Exact)
+
+	a.setenv("VARS", "a,bad")
+	err := a.runWithFuncs(&config{}, parsers)
+	var perr *ParseError
+	if assert.True(t, errors.As(err, &perr)) {
+		assert.Equal(t, "Vars", perr.Field)
+		assert.Contains(t, perr.Err.Error(), `element 1 "bad"`)
+		assert.Contains(t, perr.Err.Error(), "bad foo")
+	}
 }
 
-func testParseWithFuncsInvalidType(t *testing.T, a TestAgainst) {
-	var c int
-	err := a.runWithFuncs(&c, nil)
-	assert.Error(t, err)
-	assert.Equal(t, err, ErrNotAStructPtr)
+type logLevel int
+
+func (l *logLevel) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "debug":
+		*l = 0
+	case "info":
+		*l = 1
+	default:
+		return fmt.Errorf("unknown level %q", text)
+	}
+	return nil
 }
 
-func testCustomParserError(t *testing.T, a TestAgainst) {
-	type foo struct {
-		name string
+func testTextUnmarshaler(t *testing.T, a TestAgainst) {
+	type config struct {
+		Level    logLevel  `env:"LEVEL"`
+		LevelPtr *logLevel `env:"LEVEL_PTR"`
+		Custom   logLevel  `env:"CUSTOM"`
 	}
 
+	a.setenv("LEVEL", "info")
+	a.setenv("LEVEL_PTR", "info")
+	a.setenv("CUSTOM", "5")
+	defer os.Clearenv()
+
+	cfg := &config{}
+	assert.NoError(t, a.runWithFuncs(cfg, CustomParsers{
+		reflect.TypeOf(logLevel(0)): func(v string) (interface{}, error) {
+			if v == "info" {
+				return logLevel(1), nil
+			}
+			return logLevel(42), nil
+		},
+	}))
+	assert.Equal(t, logLevel(42), cfg.Custom)
+
+	cfg = &config{}
+	a.setenv("CUSTOM", "debug")
+	assert.NoError(t, a.run(cfg))
+	assert.Equal(t, logLevel(1), cfg.Level)
+	if assert.NotNil(t, cfg.LevelPtr) {
+		assert.Equal(t, logLevel(1), *cfg.LevelPtr)
+	}
+	assert.Equal(t, logLevel(0), cfg.Custom)
+
+	a.setenv("LEVEL", "verbose")
+	err := a.run(&config{})
+	var perr *ParseError
+	if assert.True(t, errors.As(err, &perr)) {
+		assert.Equal(t, "Level", perr.Field)
+	}
+}
+
+func testParsesJSON(t *testing.T, a TestAgainst) {
+	type retry struct {
+		Max  int    `json:"max"`
+		Base string `json:"base"`
+	}
+	type server struct {
+		Host string `json:"host"`
+		Port int    `json:"port"`
+	}
 	type config struct {
-		Var foo `env:"VAR"`
+		Retry   retry          `env:"RETRY" envJSON:"true"`
+		Limits  map[string]int `env:"LIMITS" envJSON:"true"`
+		Tags    []string       `env:"TAGS" envJSON:"true"`
+		Servers []server       `env:"SERVERS" envJSON:"true"`
+		None    []server       `env:"NONE" envJSON:"true"`
 	}
 
-	a.setenv("VAR", "test")
+	a.setenv("RETRY", `{"max":3,"base":"1s"}`)
+	a.setenv("LIMITS", `{"a":1,"b":2}`)
+	a.setenv("TAGS", `["x,y","z"]`)
+	a.setenv("SERVERS", `[{"host":"a","port":80},{"host":"b"}]`)
+	defer os.Clearenv()
 
-	customParserFunc := func(v string) (interface{}, error) {
-		return nil, errors.New("something broke")
+	cfg := &config{}
+	assert.NoError(t, a.run(cfg))
+	assert.Equal(t, retry{Max: 3, Base: "1s"}, cfg.Retry)
+	assert.Equal(t, map[string]int{"a": 1, "b": 2}, cfg.Limits)
+	assert.Equal(t, []string{"x,y", "z"}, cfg.Tags)
+	assert.Equal(t, []server{{Host: "a", Port: 80}, {Host: "b"}}, cfg.Servers)
+	assert.Nil(t, cfg.None)
+
+	a.setenv("RETRY", `{"max":`)
+	err := a.run(&config{})
+	var perr *ParseError
+	if assert.True(t, errors.As(err, &perr)) {
+		assert.Equal(t, "Retry", perr.Field)
+	}
+
+	a.setenv("RETRY", `{}`)
+	a.setenv("SERVERS", `[{"host":"a"},`)
+	err = a.run(&config{})
+	if assert.True(t, errors.As(err, &perr)) {
+		assert.Equal(t, "Servers", perr.Field)
+	}
+}
+
+func testParsesPointers(t *testing.T, a TestAgainst) {
+	type inner struct {
+		Number *uint `env:"NUMBER"`
+	}
+	type config struct {
+		Port     *int           `env:"PORT"`
+		Name     *string        `env:"NAME" envDefault:"default"`
+		Debug    *bool          `env:"DEBUG"`
+		Timeout  *time.Duration `env:"TIMEOUT"`
+		StartsAt *time.Time     `env:"STARTS_AT" envLayout:"2006-01-02"`
+		Unset    *int           `env:"UNSET"`
+		Inner    *inner
+	}
+
+	a.setenv("PORT", "0")
+	a.setenv("DEBUG", "true")
+	a.setenv("TIMEOUT", "1s")
+	a.setenv("STARTS_AT", "2018-04-05")
+	a.setenv("NUMBER", "3")
+	defer os.Clearenv()
+
+	cfg := &config{Inner: &inner{}}
+	assert.NoError(t, a.run(cfg))
+	if assert.NotNil(t, cfg.Port) {
+		assert.Equal(t, 0, *cfg.Port)
 	}
+	if assert.NotNil(t, cfg.Name) {
+		assert.Equal(t, "default", *cfg.Name)
+	}
+	if assert.NotNil(t, cfg.Debug) {
+		assert.Equal(t, true, *cfg.Debug)
+	}
+	if assert.NotNil(t, cfg.Timeout) {
+		assert.Equal(t, time.Second, *cfg.Timeout)
+	}
+	if assert.NotNil(t, cfg.StartsAt) {
+		assert.Equal(t, time.Date(2018, 4, 5, 0, 0, 0, 0, time.UTC), *cfg.StartsAt)
+	}
+	assert.Nil(t, cfg.Unset)
+	if assert.NotNil(t, cfg.Inner.Number) {
+		assert.Equal(t, uint(3), *cfg.Inner.Number)
+	}
+
+	a.setenv("PORT", "not-a-port")
+	err := a.run(&config{})
+	var perr *ParseError
+	if assert.True(t, errors.As(err, &perr)) {
+		assert.Equal(t, "Port", perr.Field)
+	}
+}
+
+func testParsesIntBase(t *testing.T, a TestAgainst) {
+	type config struct {
+		Mask   uint32 `env:"MASK" envBase:"0"`
+		Perm   int    `env:"PERM" envBase:"0"`
+		Flags  uint8  `env:"FLAGS" envBase:"0"`
+		Offset int64  `env:"OFFSET" envBase:"0"`
+		Color  *uint  `env:"COLOR" envBase:"16"`
+		Plain  int    `env:"PLAIN"`
+
+		Masks   []int          `env:"MASKS" envBase:"16"`
+		Offsets []int64        `env:"OFFSETS" envBase:"0"`
+		Sizes   []uint64       `env:"SIZES" envBase:"2"`
+		Ports   []uint16       `env:"PORTS" envBase:"16"`
+		Colors  map[string]int `env:"COLORS" envBase:"16"`
+	}
+
+	a.setenv("MASK", "0xFF00")
+	a.setenv("PERM", "0o755")
+	a.setenv("FLAGS", "0b101")
+	a.setenv("OFFSET", "-12")
+	a.setenv("COLOR", "ff8800")
+	a.setenv("PLAIN", "010")
+	a.setenv("MASKS", "ff,10")
+	a.setenv("OFFSETS", "0x10,-0b11,7")
+	a.setenv("SIZES", "101,11")
+	a.setenv("PORTS", "1f90,50")
+	a.setenv("COLORS", "red:ff0000,blue:ff")
+	defer os.Clearenv()
 
 	cfg := &config{}
-	err := a.runWithFuncs(cfg, map[reflect.Type]ParserFunc{
-		reflect.TypeOf(foo{}): customParserFunc,
-	})
+	assert.NoError(t, a.run(cfg))
+	assert.Equal(t, uint32(0xFF00), cfg.Mask)
+	assert.Equal(t, 0o755, cfg.Perm)
+	assert.Equal(t, uint8(5), cfg.Flags)
+	assert.Equal(t, int64(-12), cfg.Offset)
+	if assert.NotNil(t, cfg.Color) {
+		assert.Equal(t, uint(0xff8800), *cfg.Color)
+	}
+	assert.Equal(t, 10, cfg.Plain)
+	assert.Equal(t, []int{0xff, 0x10}, cfg.Masks)
+	assert.Equal(t, []int64{0x10, -3, 7}, cfg.Offsets)
+	assert.Equal(t, []uint64{5, 3}, cfg.Sizes)
+	assert.Equal(t, []uint16{8080, 80}, cfg.Ports)
+	assert.Equal(t, map[string]int{"red": 0xff0000, "blue": 0xff}, cfg.Colors)
+}
 
-	assert.Empty(t, cfg.Var.name, "Var.name should not be filled out when parse errors")
+func testInvalidIntBase(t *testing.T, a TestAgainst) {
+	type hex struct {
+		Mask uint32 `env:"MASK" envBase:"16"`
+	}
+	type base struct {
+		Mask uint32 `env:"MASK" envBase:"1"`
+	}
+
+	a.setenv("MASK", "0xFG")
+	defer os.Clearenv()
+
+	err := a.run(&hex{})
+	var perr *ParseError
+	if assert.True(t, errors.As(err, &perr)) {
+		assert.Equal(t, "Mask", perr.Field)
+		assert.True(t, errors.Is(err, strconv.ErrSyntax))
+	}
+
+	a.setenv("MASK", "1")
+	err = a.run(&base{})
 	assert.Error(t, err)
-	assert.Equal(t, err.Error(), "Custom parser error: something broke")
+	assert.Contains(t, err.Error(), `Invalid envBase "1"`)
 }
 
-func testUnsupportedStructType(t *testing.T, a TestAgainst) {
+func testParsesFileMode(t *testing.T, a TestAgainst) {
 	type config struct {
-		Foo http.Client `env:"FOO"`
+		Umask os.FileMode   `env:"UMASK"`
+		Perm  *os.FileMode  `env:"PERM" envDefault:"0o755"`
+		Modes []os.FileMode `env:"MODES"`
 	}
 
-	a.setenv("FOO", "foo")
+	a.setenv("UMASK", "0644")
+	a.setenv("MODES", "600, 0640")
+	defer os.Clearenv()
+
+	cfg := &config{}
+	assert.NoError(t, a.run(cfg))
+	assert.Equal(t, os.FileMode(0o644), cfg.Umask)
+	if assert.NotNil(t, cfg.Perm) {
+		assert.Equal(t, os.FileMode(0o755), *cfg.Perm)
+	}
+	assert.Equal(t, []os.FileMode{0o600, 0o640}, cfg.Modes)
+
+	a.setenv("UMASK", "0648")
+	err := a.run(&config{})
+	var perr *ParseError
+	if assert.True(t, errors.As(err, &perr)) {
+		assert.Equal(t, "Umask", perr.Field)
+		assert.Contains(t, err.Error(), `Invalid file mode "0648"`)
+	}
+}
+
+func testParsesLocation(t *testing.T, a TestAgainst) {
+	type config struct {
+		TZ      *time.Location `env:"TZ"`
+		Default *time.Location `env:"DEFAULT_TZ" envDefault:"UTC"`
+		Unset   *time.Location `env:"UNSET_TZ"`
+	}
+
+	a.setenv("TZ", "America/New_York")
+	defer os.Clearenv()
+
+	cfg := &config{}
+	assert.NoError(t, a.run(cfg))
+	if assert.NotNil(t, cfg.TZ) {
+		assert.Equal(t, "America/New_York", cfg.TZ.String())
+	}
+	assert.Equal(t, time.UTC, cfg.Default)
+	assert.Nil(t, cfg.Unset)
+
+	a.setenv("TZ", "Mars/Olympus_Mons")
+	err := a.run(&config{})
+	var perr *ParseError
+	if assert.True(t, errors.As(err, &perr)) {
+		assert.Equal(t, "TZ", perr.Field)
+	}
+}
+
+func testParsesSlicePointers(t *testing.T, a TestAgainst) {
+	type config struct {
+		Tags    *[]string        `env:"TAGS"`
+		Empty   *[]string        `env:"EMPTY"`
+		Unset   *[]string        `env:"UNSET"`
+		Ports   *[]int           `env:"PORTS" envDefault:"80;443" envSeparator:";"`
+		NoPorts *[]int           `env:"NO_PORTS" envDefault:""`
+		Times   *[]time.Duration `env:"TIMES"`
+	}
+
+	a.setenv("TAGS", "a,b")
+	a.setenv("EMPTY", "")
+	a.setenv("TIMES", "1s,x")
+	defer os.Clearenv()
 
 	cfg := &config{}
 	err := a.run(cfg)
+	var perr *ParseError
+	if assert.True(t, errors.As(err, &perr)) {
+		assert.Equal(t, "Times", perr.Field)
+	}
 
-	assert.Error(t, err)
-	assert.Equal(t, ErrUnsupportedType, err)
+	a.setenv("TIMES", "1s")
+	cfg = &config{}
+	assert.NoError(t, a.run(cfg))
+	if assert.NotNil(t, cfg.Tags) {
+		assert.Equal(t, []string{"a", "b"}, *cfg.Tags)
+	}
+	if assert.NotNil(t, cfg.Empty) {
+		assert.Equal(t, []string{}, *cfg.Empty)
+	}
+	assert.Nil(t, cfg.Unset)
+	if assert.NotNil(t, cfg.Ports) {
+		assert.Equal(t, []int{80, 443}, *cfg.Ports)
+	}
+	if assert.NotNil(t, cfg.NoPorts) {
+		assert.Empty(t, *cfg.NoPorts)
+	}
+	if assert.NotNil(t, cfg.Times) {
+		assert.Equal(t, []time.Duration{time.Second}, *cfg.Times)
+	}
 }
-func testEmptyOption(t *testing.T, a TestAgainst) {
+
+func testParsesSizedInts(t *testing.T, a TestAgainst) {
 	type config struct {
-		Var string `env:"VAR,"`
+		Priority int8     `env:"PRIORITY"`
+		Int16    int16    `env:"INT16"`
+		Int32    int32    `env:"INT32"`
+		Byte     byte     `env:"BYTE"`
+		MaxConns uint16   `env:"MAX_CONNS"`
+		Uint32   uint32   `env:"UINT32"`
+		Ports    []uint16 `env:"PORTS"`
+		Offsets  []int8   `env:"OFFSETS"`
 	}
 
+	a.setenv("PRIORITY", "-128")
+	a.setenv("INT16", "32767")
+	a.setenv("INT32", "-2147483648")
+	a.setenv("BYTE", "255")
+	a.setenv("MAX_CONNS", "65535")
+	a.setenv("UINT32", "4294967295")
+	a.setenv("PORTS", "80,443")
+	a.setenv("OFFSETS", "-1,1")
+	defer os.Clearenv()
+
 	cfg := &config{}
+	assert.NoError(t, a.run(cfg))
+	assert.Equal(t, int8(-128), cfg.Priority)
+	assert.Equal(t, int16(32767), cfg.Int16)
+	assert.Equal(t, int32(-2147483648), cfg.Int32)
+	assert.Equal(t, byte(255), cfg.Byte)
+	assert.Equal(t, uint16(65535), cfg.MaxConns)
+	assert.Equal(t, uint32(4294967295), cfg.Uint32)
+	assert.Equal(t, []uint16{80, 443}, cfg.Ports)
+	assert.Equal(t, []int8{-1, 1}, cfg.Offsets)
+
+	for key, value := range map[string]string{
+		"PRIORITY":  "128",
+		"BYTE":      "256",
+		"MAX_CONNS": "65536",
+		"PORTS":     "80,65536",
+	} {
+		os.Clearenv()
+		a.setenv(key, value)
+		err := a.run(&config{})
+		var perr *ParseError
+		if assert.True(t, errors.As(err, &perr), key) {
+			assert.Contains(t, perr.Key, key)
+		}
+	}
+}
 
-	a.setenv("VAR", "val")
+func testParsesComplex(t *testing.T, a TestAgainst) {
+	type config struct {
+		C64  complex64    `env:"C64"`
+		C128 complex128   `env:"C128"`
+		Cs   []complex128 `env:"CS" envSeparator:";"`
+	}
+
+	a.setenv("C64", "1+2i")
+	a.setenv("C128", "(-3.5-4i)")
+	a.setenv("CS", "1;2i;3+4i")
 	defer os.Clearenv()
+
+	cfg := &config{}
 	assert.NoError(t, a.run(cfg))
-	assert.Equal(t, "val", cfg.Var)
+	assert.Equal(t, complex64(1+2i), cfg.C64)
+	assert.Equal(t, complex128(-3.5-4i), cfg.C128)
+	assert.Equal(t, []complex128{1, 2i, 3 + 4i}, cfg.Cs)
+
+	a.setenv("C128", "not-complex")
+	err := a.run(&config{})
+	var perr *ParseError
+	if assert.True(t, errors.As(err, &perr)) {
+		assert.Equal(t, "C128", perr.Field)
+	}
+	a.setenv("C128", "1")
+	a.setenv("CS", "1;x")
+	assert.Error(t, a.run(&config{}))
 }
 
-func testErrorOptionNotRecognized(t *testing.T, a TestAgainst) {
+func testParsesBytes(t *testing.T, a TestAgainst) {
 	type config struct {
-		Var string `env:"VAR,not_supported!"`
+		Raw    []byte `env:"RAW"`
+		Base64 []byte `env:"BASE64" envEncoding:"base64"`
+		Hex    []byte `env:"HEX" envEncoding:"hex"`
 	}
 
+	a.setenv("RAW", "a,b")
+	a.setenv("BASE64", "aGVsbG8=")
+	a.setenv("HEX", "deadbeef")
+	defer os.Clearenv()
+
 	cfg := &config{}
-	assert.Error(t, a.run(cfg))
+	assert.NoError(t, a.run(cfg))
+	assert.Equal(t, []byte("a,b"), cfg.Raw)
+	assert.Equal(t, []byte("hello"), cfg.Base64)
+	assert.Equal(t, []byte{0xde, 0xad, 0xbe, 0xef}, cfg.Hex)
+
+	a.setenv("HEX", "not-hex")
+	err := a.run(&config{})
+	var perr *ParseError
+	if assert.True(t, errors.As(err, &perr)) {
+		assert.Equal(t, "Hex", perr.Field)
+	}
+}
+
+func testBounds(t *testing.T, a TestAgainst) {
+	type config struct {
+		Port  int     `env:"PORT,required" envMin:"1" envMax:"65535"`
+		Small uint8   `env:"SMALL" envMax:"10"`
+		Ratio float64 `env:"RATIO" envMin:"0" envMax:"1"`
+		Ptr   *int32  `env:"PTR" envMin:"-5"`
+	}
+	type badConfig struct {
+		Name string `env:"NAME" envMin:"1"`
+	}
+
+	a.setenv("PORT", "8080")
+	a.setenv("SMALL", "10")
+	a.setenv("RATIO", "0.5")
+	a.setenv("PTR", "-5")
+	defer os.Clearenv()
+
+	cfg := &config{}
+	assert.NoError(t, a.run(cfg))
+	assert.Equal(t, 8080, cfg.Port)
+
+	for key, value := range map[string]string{
+		"PORT":  "0",
+		"SMALL": "11",
+		"RATIO": "1.5",
+		"PTR":   "-6",
+	} {
+		old := os.Getenv(key)
+		if old == "" {
+			old = os.Getenv("PREFIX_" + key)
+		}
+		a.setenv(key, value)
+		err := a.run(&config{})
+		assert.Error(t, err, key)
+		assert.Contains(t, err.Error(), value, key)
+		a.setenv(key, old)
+	}
+
+	err := a.run(&config{Port: 0})
+	assert.NoError(t, err)
+
+	a.setenv("PORT", "70000")
+	err = a.run(&config{})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "envMax 65535")
+
+	err = a.run(&badConfig{})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Name")
+}
+
+func testDurationBounds(t *testing.T, a TestAgainst) {
+	type config struct {
+		Timeout time.Duration  `env:"TIMEOUT" envMin:"0"`
+		Retry   *time.Duration `env:"RETRY" envMin:"100ms" envMax:"1m"`
+	}
+	type badConfig struct {
+		Timeout time.Duration `env:"TIMEOUT" envMin:"10"`
+	}
+
+	a.setenv("TIMEOUT", "5s")
+	a.setenv("RETRY", "1m")
+	defer os.Clearenv()
+
+	cfg := &config{}
+	assert.NoError(t, a.run(cfg))
+	assert.Equal(t, 5*time.Second, cfg.Timeout)
+	assert.Equal(t, time.Minute, *cfg.Retry)
+
+	a.setenv("TIMEOUT", "-1s")
+	err := a.run(&config{})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Value -1s is lower than envMin 0")
+
+	a.setenv("TIMEOUT", "0s")
+	a.setenv("RETRY", "50ms")
+	err = a.run(&config{})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "envMin 100ms")
+
+	a.setenv("RETRY", "2m")
+	err = a.run(&config{})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "envMax 1m")
+
+	err = a.run(&badConfig{})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), `Invalid envMin "10"`)
+}
+
+func testParseWithFuncsNoPtr(t *testing.T, a TestAgainst) {
+	type foo struct{}
+	err := a.runWithFuncs(foo{}, nil)
+	assert.Error(t, err)
+	assert.Equal(t, err, ErrNotAStructPtr)
+}
+
+func testParseWithFuncsInvalidType(t *testing.T, a TestAgainst) {
+	var c int
+	err := a.runWithFuncs(&c, nil)
+	assert.Error(t, err)
+	assert.Equal(t, err, ErrNotAStructPtr)
+}
+
+func testCustomParserError(t *testing.T, a TestAgainst) {
+	type foo struct {
+		name string
+	}
+
+	type config struct {
+		Var foo `env:"VAR"`
+	}
+
+	a.setenv("VAR", "test")
+
+	customParserFunc := func(v string) (interface{}, error) {
+		return nil, errors.New("something broke")
+	}
+
+	cfg := &config{}
+	err := a.runWithFuncs(cfg, map[reflect.Type]ParserFunc{
+		reflect.TypeOf(foo{}): customParserFunc,
+	})
+
+	assert.Empty(t, cfg.Var.name, "Var.name should not be filled out when parse errors")
+	assert.Error(t, err)
+	assert.Equal(t, errors.Unwrap(err).Error(), "Custom parser error: something broke")
+}
+
+func testUnsupportedStructType(t *testing.T, a TestAgainst) {
+	type config struct {
+		Foo http.Client `env:"FOO"`
+	}
+
+	a.setenv("FOO", "foo")
+
+	cfg := &config{}
+	err := a.run(cfg)
+
+	assert.Error(t, err)
+	assert.True(t, errors.Is(err, ErrUnsupportedType))
+}
+func testEmptyOption(t *testing.T, a TestAgainst) {
+	type config struct {
+		Var string `env:"VAR,"`
+	}
+
+	cfg := &config{}
+
+	a.setenv("VAR", "val")
+	defer os.Clearenv()
+	assert.NoError(t, a.run(cfg))
+	assert.Equal(t, "val", cfg.Var)
+}
+
+func testErrorOptionNotRecognized(t *testing.T, a TestAgainst) {
+	type config struct {
+		Var string `env:"VAR,not_supported!"`
+	}
+
+	cfg := &config{}
+	assert.Error(t, a.run(cfg))
+
+}
+
+func testParsesTime(t *testing.T, a TestAgainst) {
+	type config struct {
+		StartsAt time.Time `env:"STARTS_AT" envLayout:"2006-01-02"`
+		EndsAt   time.Time `env:"ENDS_AT"`
+	}
+
+	a.setenv("STARTS_AT", "2018-04-05")
+	a.setenv("ENDS_AT", "2018-04-06T12:30:00Z")
+	defer os.Clearenv()
+
+	cfg := &config{}
+	assert.NoError(t, a.run(cfg))
+	assert.Equal(t, time.Date(2018, 4, 5, 0, 0, 0, 0, time.UTC), cfg.StartsAt)
+	assert.Equal(t, time.Date(2018, 4, 6, 12, 30, 0, 0, time.UTC), cfg.EndsAt)
+}
+
+func testParsesUnixTime(t *testing.T, a TestAgainst) {
+	type config struct {
+		Expires  time.Time   `env:"EXPIRES" envLayout:"unix"`
+		IssuedAt *time.Time  `env:"ISSUED_AT" envLayout:"unixmilli"`
+		Windows  []time.Time `env:"WINDOWS" envLayout:"unix"`
+	}
+
+	a.setenv("EXPIRES", "1700000000")
+	a.setenv("ISSUED_AT", "1700000000250")
+	a.setenv("WINDOWS", "0,-60")
+	defer os.Clearenv()
+
+	cfg := &config{}
+	assert.NoError(t, a.run(cfg))
+	assert.Equal(t, time.Date(2023, 11, 14, 22, 13, 20, 0, time.UTC), cfg.Expires)
+	assert.Equal(t, time.Date(2023, 11, 14, 22, 13, 20, 250*int(time.Millisecond), time.UTC), *cfg.IssuedAt)
+	assert.Equal(t, []time.Time{
+		time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(1969, 12, 31, 23, 59, 0, 0, time.UTC),
+	}, cfg.Windows)
+
+	a.setenv("EXPIRES", "2023-11-14")
+	err := a.run(&config{})
+	var perr *ParseError
+	if assert.True(t, errors.As(err, &perr)) {
+		assert.Equal(t, "Expires", perr.Field)
+		assert.Contains(t, perr.Err.Error(), `layout "unix"`)
+	}
+}
+
+func testParsesTimes(t *testing.T, a TestAgainst) {
+	type config struct {
+		Windows []time.Time `env:"WINDOWS" envLayout:"15:04"`
+		Dates   []time.Time `env:"DATES" envSeparator:";"`
+	}
+
+	a.setenv("WINDOWS", "08:00,12:30")
+	a.setenv("DATES", "2018-04-05T00:00:00Z;2018-04-06T12:30:00Z")
+	defer os.Clearenv()
+
+	cfg := &config{}
+	assert.NoError(t, a.run(cfg))
+	assert.Equal(t, []time.Time{
+		time.Date(0, 1, 1, 8, 0, 0, 0, time.UTC),
+		time.Date(0, 1, 1, 12, 30, 0, 0, time.UTC),
+	}, cfg.Windows)
+	assert.Equal(t, []time.Time{
+		time.Date(2018, 4, 5, 0, 0, 0, 0, time.UTC),
+		time.Date(2018, 4, 6, 12, 30, 0, 0, time.UTC),
+	}, cfg.Dates)
+}
+
+func testInvalidTimes(t *testing.T, a TestAgainst) {
+	type config struct {
+		Windows []time.Time `env:"WINDOWS" envLayout:"15:04"`
+	}
+
+	a.setenv("WINDOWS", "08:00,noon")
+	defer os.Clearenv()
+
+	err := a.run(&config{})
+	var perr *ParseError
+	if assert.True(t, errors.As(err, &perr)) {
+		assert.Contains(t, perr.Err.Error(), `element 1 "noon"`)
+		assert.Contains(t, perr.Err.Error(), "15:04")
+	}
+}
+
+func testParsesBigNumbers(t *testing.T, a TestAgainst) {
+	type config struct {
+		Supply  *big.Int     `env:"SUPPLY"`
+		Balance big.Int      `env:"BALANCE"`
+		Rate    *big.Float   `env:"RATE"`
+		Price   big.Float    `env:"PRICE"`
+		Primes  []*big.Int   `env:"PRIMES"`
+		Rates   []*big.Float `env:"RATES" envSeparator:";"`
+		Unset   *big.Int     `env:"UNSET"`
+	}
+
+	a.setenv("SUPPLY", "123456789012345678901234567890")
+	a.setenv("BALANCE", "-42")
+	a.setenv("RATE", "0.125")
+	a.setenv("PRICE", "12345678901234567890.123456789")
+	a.setenv("PRIMES", "2,3,170141183460469231731687303715884105727")
+	a.setenv("RATES", "1.5;2.5")
+	defer os.Clearenv()
+
+	cfg := &config{}
+	assert.NoError(t, a.run(cfg))
+	supply, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+	mersenne, _ := new(big.Int).SetString("170141183460469231731687303715884105727", 10)
+	assert.Equal(t, 0, supply.Cmp(cfg.Supply))
+	assert.Equal(t, int64(-42), cfg.Balance.Int64())
+	assert.Equal(t, "0.125", cfg.Rate.Text('g', -1))
+	assert.Equal(t, "12345678901234567890.123456789", cfg.Price.Text('f', 9))
+	if assert.Len(t, cfg.Primes, 3) {
+		assert.Equal(t, 0, mersenne.Cmp(cfg.Primes[2]))
+	}
+	if assert.Len(t, cfg.Rates, 2) {
+		assert.Equal(t, "2.5", cfg.Rates[1].Text('g', -1))
+	}
+	assert.Nil(t, cfg.Unset)
+}
+
+func testInvalidBigNumbers(t *testing.T, a TestAgainst) {
+	type config struct {
+		Supply *big.Int `env:"SUPPLY"`
+	}
+
+	a.setenv("SUPPLY", "0x10")
+	defer os.Clearenv()
+
+	err := a.run(&config{})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "into field Supply")
+	assert.Contains(t, err.Error(), `Unable to parse "0x10" as big.Int`)
+
+	type floats struct {
+		Rates []*big.Float `env:"RATES"`
+	}
+	a.setenv("RATES", "1.5,abc")
+	err = a.run(&floats{})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), `Unable to parse "abc" as big.Float`)
+}
+
+func testParsesDurationUnit(t *testing.T, a TestAgainst) {
+	type config struct {
+		Timeout   time.Duration   `env:"TIMEOUT" envDurationUnit:"s"`
+		Explicit  time.Duration   `env:"EXPLICIT" envDurationUnit:"s"`
+		Fraction  *time.Duration  `env:"FRACTION" envDurationUnit:"m"`
+		Intervals []time.Duration `env:"INTERVALS" envDurationUnit:"ms"`
+	}
+
+	a.setenv("TIMEOUT", "30")
+	a.setenv("EXPLICIT", "500ms")
+	a.setenv("FRACTION", "1.5")
+	a.setenv("INTERVALS", "10,1s")
+	defer os.Clearenv()
+
+	cfg := &config{}
+	assert.NoError(t, a.run(cfg))
+	assert.Equal(t, 30*time.Second, cfg.Timeout)
+	assert.Equal(t, 500*time.Millisecond, cfg.Explicit)
+	assert.Equal(t, 90*time.Second, *cfg.Fraction)
+	assert.Equal(t, []time.Duration{10 * time.Millisecond, time.Second}, cfg.Intervals)
+}
+
+func testInvalidDurationUnit(t *testing.T, a TestAgainst) {
+	type config struct {
+		Timeout time.Duration `env:"TIMEOUT" envDurationUnit:"s"`
+	}
+	defer os.Clearenv()
+
+	a.setenv("TIMEOUT", "thirty")
+	assert.Error(t, a.run(&config{}))
+
+	type badUnit struct {
+		Timeout time.Duration `env:"TIMEOUT" envDurationUnit:"fortnight"`
+	}
+	a.setenv("TIMEOUT", "30")
+	err := a.run(&badUnit{})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown unit")
+
+	type noUnit struct {
+		Timeout time.Duration `env:"TIMEOUT"`
+	}
+	assert.Error(t, a.run(&noUnit{}))
+}
+
+func testInvalidTime(t *testing.T, a TestAgainst) {
+	type config struct {
+		StartsAt time.Time `env:"STARTS_AT" envLayout:"2006-01-02"`
+	}
+
+	a.setenv("STARTS_AT", "05/04/2018")
+	defer os.Clearenv()
+
+	cfg := &config{}
+	err := a.run(cfg)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "StartsAt")
+	assert.Contains(t, err.Error(), "05/04/2018")
+	assert.Contains(t, err.Error(), "2006-01-02")
+}
+
+func testParsesNet(t *testing.T, a TestAgainst) {
+	type config struct {
+		Bind   net.IP     `env:"BIND_ADDR"`
+		Subnet *net.IPNet `env:"SUBNET"`
+		Peers  []net.IP   `env:"PEERS" envSeparator:";"`
+	}
+
+	a.setenv("BIND_ADDR", "127.0.0.1")
+	a.setenv("SUBNET", "10.0.0.0/8")
+	a.setenv("PEERS", "10.0.0.1;::1")
+	defer os.Clearenv()
+
+	cfg := &config{}
+	assert.NoError(t, a.run(cfg))
+	assert.Equal(t, net.ParseIP("127.0.0.1"), cfg.Bind)
+	assert.Equal(t, "10.0.0.0/8", cfg.Subnet.String())
+	assert.Equal(t, []net.IP{net.ParseIP("10.0.0.1"), net.ParseIP("::1")}, cfg.Peers)
+}
+
+func testParsesMAC(t *testing.T, a TestAgainst) {
+	type config struct {
+		MAC     net.HardwareAddr   `env:"MAC"`
+		Default net.HardwareAddr   `env:"DEFAULT" envDefault:"00-00-5e-00-53-01"`
+		Devices []net.HardwareAddr `env:"DEVICES"`
+	}
+
+	a.setenv("MAC", "00:1b:63:84:45:e6")
+	a.setenv("DEVICES", "00:1b:63:84:45:e6,0000.5e00.5301")
+	defer os.Clearenv()
+
+	cfg := &config{}
+	assert.NoError(t, a.run(cfg))
+	mac, _ := net.ParseMAC("00:1b:63:84:45:e6")
+	other, _ := net.ParseMAC("00:00:5e:00:53:01")
+	assert.Equal(t, mac, cfg.MAC)
+	assert.Equal(t, other, cfg.Default)
+	assert.Equal(t, []net.HardwareAddr{mac, other}, cfg.Devices)
+
+	a.setenv("MAC", "not-a-mac")
+	err := a.run(&config{})
+	var perr *ParseError
+	if assert.True(t, errors.As(err, &perr)) {
+		assert.Equal(t, "MAC", perr.Field)
+	}
+
+	a.setenv("MAC", "00:1b:63:84:45:e6")
+	a.setenv("DEVICES", "00:1b:63:84:45:e6,zz")
+	assert.Error(t, a.run(&config{}))
+}
+
+func testParsesRegexp(t *testing.T, a TestAgainst) {
+	type config struct {
+		Filter  *regexp.Regexp   `env:"FILTER"`
+		Default *regexp.Regexp   `env:"DEFAULT" envDefault:"^[a-z]+$"`
+		Ignore  []*regexp.Regexp `env:"IGNORE" envSeparator:" "`
+		Unset   *regexp.Regexp   `env:"UNSET"`
+	}
+
+	a.setenv("FILTER", `^v\d+\.\d+$`)
+	a.setenv("IGNORE", `\.tmp$ ^_`)
+	defer os.Clearenv()
+
+	cfg := &config{}
+	assert.NoError(t, a.run(cfg))
+	assert.True(t, cfg.Filter.MatchString("v1.2"))
+	assert.False(t, cfg.Filter.MatchString("v1"))
+	assert.Equal(t, "^[a-z]+$", cfg.Default.String())
+	if assert.Len(t, cfg.Ignore, 2) {
+		assert.True(t, cfg.Ignore[0].MatchString("a.tmp"))
+		assert.True(t, cfg.Ignore[1].MatchString("_a"))
+	}
+	assert.Nil(t, cfg.Unset)
+
+	a.setenv("FILTER", "([a-z]")
+	err := a.run(&config{})
+	var perr *ParseError
+	if assert.True(t, errors.As(err, &perr)) {
+		assert.Equal(t, "Filter", perr.Field)
+		assert.Contains(t, perr.Err.Error(), "missing closing )")
+	}
+}
+
+func testInvalidNet(t *testing.T, a TestAgainst) {
+	type ipConfig struct {
+		Bind net.IP `env:"BIND_ADDR"`
+	}
+	type ipNetConfig struct {
+		Subnet *net.IPNet `env:"SUBNET"`
+	}
+	type ipsConfig struct {
+		Peers []net.IP `env:"PEERS"`
+	}
+
+	a.setenv("BIND_ADDR", "not-an-ip")
+	a.setenv("SUBNET", "10.0.0.0/99")
+	a.setenv("PEERS", "10.0.0.1,10.0.0.256")
+	defer os.Clearenv()
+
+	err := a.run(&ipConfig{})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Bind")
+	assert.Contains(t, err.Error(), "not-an-ip")
+
+	err = a.run(&ipNetConfig{})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Subnet")
+	assert.Contains(t, err.Error(), "10.0.0.0/99")
+
+	err = a.run(&ipsConfig{})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Peers")
+	assert.Contains(t, err.Error(), "10.0.0.256")
+}
+
+func testParsesURL(t *testing.T, a TestAgainst) {
+	type config struct {
+		Endpoint *url.URL `env:"ENDPOINT" envDefault:"https://example.com"`
+		Callback url.URL  `env:"CALLBACK"`
+	}
+
+	a.setenv("CALLBACK", "http://localhost:8080/cb?x=1")
+	defer os.Clearenv()
+
+	cfg := &config{}
+	assert.NoError(t, a.run(cfg))
+	assert.Equal(t, "https://example.com", cfg.Endpoint.String())
+	assert.Equal(t, "localhost:8080", cfg.Callback.Host)
+	assert.Equal(t, "/cb", cfg.Callback.Path)
+}
+
+func testInvalidURL(t *testing.T, a TestAgainst) {
+	type config struct {
+		Endpoint *url.URL `env:"ENDPOINT"`
+	}
+
+	a.setenv("ENDPOINT", "http://[::1")
+	defer os.Clearenv()
+
+	err := a.run(&config{})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Endpoint")
+}
+
+func testParsesQuery(t *testing.T, a TestAgainst) {
+	type config struct {
+		Params  url.Values          `env:"PARAMS"`
+		Options map[string][]string `env:"OPTIONS" envQuery:"true"`
+		Ptr     *url.Values         `env:"PTR"`
+		Empty   url.Values          `env:"EMPTY"`
+		Unset   url.Values          `env:"UNSET"`
+	}
+
+	a.setenv("PARAMS", "a=1&b=2&a=3")
+	a.setenv("OPTIONS", "region=eu&tag=x%20y")
+	a.setenv("PTR", "c=4")
+	a.setenv("EMPTY", "")
+	defer os.Clearenv()
+
+	cfg := &config{}
+	assert.NoError(t, a.run(cfg))
+	assert.Equal(t, url.Values{"a": {"1", "3"}, "b": {"2"}}, cfg.Params)
+	assert.Equal(t, map[string][]string{"region": {"eu"}, "tag": {"x y"}}, cfg.Options)
+	assert.Equal(t, "4", cfg.Ptr.Get("c"))
+	assert.NotNil(t, cfg.Empty)
+	assert.Len(t, cfg.Empty, 0)
+	assert.Nil(t, cfg.Unset)
+}
+
+func testInvalidQuery(t *testing.T, a TestAgainst) {
+	type config struct {
+		Params url.Values `env:"PARAMS"`
+	}
+
+	a.setenv("PARAMS", "a=%zz")
+	defer os.Clearenv()
+
+	err := a.run(&config{})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Params")
+}
+
+func testParsesMaps(t *testing.T, a TestAgainst) {
+	type config struct {
+		Flags  map[string]int      `env:"FLAGS"`
+		Labels map[string]string   `env:"LABELS" envSeparator:";" envKeyValSeparator:"="`
+		Empty  map[string]string   `env:"EMPTY"`
+		Multi  map[string][]string `env:"HEADERS" envSeparator:"|"`
+		NoMult map[string][]string `env:"NO_HEADERS"`
+		Def    map[string]int      `env:"DEF" envDefault:""`
+		Unset  map[string]string   `env:"UNSET"`
+		JSON   map[string]bool     `env:"JSON" envJSON:"true"`
+	}
+
+	a.setenv("FLAGS", "a:1,b:2")
+	a.setenv("HEADERS", "a:1|a:2|b:3")
+	a.setenv("NO_HEADERS", "")
+	a.setenv("LABELS", "app=web;tier=front:end")
+	a.setenv("EMPTY", "")
+	defer os.Clearenv()
+
+	cfg := &config{}
+	assert.NoError(t, a.run(cfg))
+	assert.Equal(t, map[string]int{"a": 1, "b": 2}, cfg.Flags)
+	assert.Equal(t, map[string]string{"app": "web", "tier": "front:end"}, cfg.Labels)
+	assert.NotNil(t, cfg.Empty)
+	assert.Len(t, cfg.Empty, 0)
+	assert.Equal(t, map[string][]string{"a": {"1", "2"}, "b": {"3"}}, cfg.Multi)
+	assert.NotNil(t, cfg.NoMult)
+	assert.Len(t, cfg.NoMult, 0)
+	assert.NotNil(t, cfg.Def)
+	assert.Len(t, cfg.Def, 0)
+	// unset is not empty
+	assert.Nil(t, cfg.Unset)
+	assert.Nil(t, cfg.JSON)
+}
+
+func testInvalidMaps(t *testing.T, a TestAgainst) {
+	type config struct {
+		Flags map[string]int `env:"FLAGS"`
+	}
+	type multi struct {
+		Headers map[string][]string `env:"HEADERS"`
+	}
+	defer os.Clearenv()
+
+	for _, v := range []string{"a:1,b", "a:1,:2", "a:1,b:x"} {
+		a.setenv("FLAGS", v)
+		err := a.run(&config{})
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "Flags")
+	}
+
+	a.setenv("HEADERS", "a:1,b")
+	err := a.run(&multi{})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Headers")
+}
+
+type hostPort struct {
+	Host string
+	Port int
+}
+
+func (h *hostPort) SetEnv(value string) error {
+	host, port, err := net.SplitHostPort(value)
+	if err != nil {
+		return err
+	}
+	h.Host = host
+	h.Port, err = strconv.Atoi(port)
+	return err
+}
+
+// UnmarshalText is never called since SetEnv takes precedence
+func (h *hostPort) UnmarshalText(text []byte) error {
+	return errors.New("UnmarshalText called")
+}
+
+type EmbeddedStruct struct {
+	Embedded string `env:"EMBEDDED"`
+}
+
+type unexportedEmbedded struct {
+	Hidden string `env:"HIDDEN"`
+}
+
+func testParsesNestedStructs(t *testing.T, a TestAgainst) {
+	type config struct {
+		EmbeddedStruct
+		unexportedEmbedded
+		Inner    InnerStruct
+		inner    InnerStruct
+		StartsAt time.Time
+	}
+
+	a.setenv("EMBEDDED", "embedded")
+	a.setenv("HIDDEN", "hidden")
+	a.setenv("innervar", "inner")
+	a.setenv("innernum", "3")
+	defer os.Clearenv()
+
+	cfg := &config{}
+	assert.NoError(t, a.run(cfg))
+	assert.Equal(t, "embedded", cfg.Embedded)
+	assert.Equal(t, "", cfg.Hidden)
+	assert.Equal(t, InnerStruct{Inner: "inner", Number: 3}, cfg.Inner)
+	assert.Equal(t, InnerStruct{}, cfg.inner)
+	assert.True(t, cfg.StartsAt.IsZero())
+
+	a.setenv("innernum", "-3")
+	assert.Error(t, a.run(&config{}))
+}
+
+func testParsesNestedPrefix(t *testing.T, a TestAgainst) {
+	type credentials struct {
+		User string `env:"USER"`
+	}
+	type database struct {
+		Host  string      `env:"HOST"`
+		Admin credentials `envPrefix:"ADMIN_"`
+	}
+	type config struct {
+		DB      database     `envPrefix:"DB_"`
+		Replica *database    `envPrefix:"REPLICA_"`
+		Inner   *InnerStruct `envPrefix:"INNER_"`
+		Host    string       `env:"HOST"`
+	}
+
+	a.setenv("HOST", "top")
+	a.setenv("DB_HOST", "db")
+	a.setenv("DB_ADMIN_USER", "admin")
+	a.setenv("REPLICA_HOST", "replica")
+	a.setenv("INNER_innervar", "inner")
+	defer os.Clearenv()
+
+	cfg := &config{Replica: &database{}, Inner: &InnerStruct{}}
+	assert.NoError(t, a.run(cfg))
+	assert.Equal(t, "top", cfg.Host)
+	assert.Equal(t, "db", cfg.DB.Host)
+	assert.Equal(t, "admin", cfg.DB.Admin.User)
+	assert.Equal(t, "replica", cfg.Replica.Host)
+	assert.Equal(t, "inner", cfg.Inner.Inner)
+}
+
+func testParsesTransform(t *testing.T, a TestAgainst) {
+	type config struct {
+		Region  string   `env:"REGION" envTransform:"upper" envTrim:"true"`
+		Scheme  string   `env:"SCHEME,oneof=http|https" envTransform:"lower"`
+		Default string   `env:"DEFAULT" envDefault:"Mixed" envTransform:"lower"`
+		Zones   []string `env:"ZONES" envTransform:"upper" envMatch:"^[A-Z,]+$"`
+	}
+
+	a.setenv("REGION", " eu-west ")
+	a.setenv("SCHEME", "HTTPS")
+	a.setenv("ZONES", "a,b")
+	defer os.Clearenv()
+
+	cfg := &config{}
+	assert.NoError(t, a.run(cfg))
+	assert.Equal(t, "EU-WEST", cfg.Region)
+	assert.Equal(t, "https", cfg.Scheme)
+	assert.Equal(t, "mixed", cfg.Default)
+	assert.Equal(t, []string{"A", "B"}, cfg.Zones)
+}
+
+func testInvalidTransform(t *testing.T, a TestAgainst) {
+	type config struct {
+		Region string `env:"REGION" envTransform:"title"`
+	}
+
+	a.setenv("REGION", "eu")
+	defer os.Clearenv()
+
+	assert.EqualError(t, a.run(&config{}), "Env transform title not supported.")
+}
+
+func testParsesRunes(t *testing.T, a TestAgainst) {
+	type config struct {
+		Delimiter rune  `env:"DELIM" envRune:"true"`
+		Arrow     *rune `env:"ARROW" envRune:"true"`
+		Number    int32 `env:"NUMBER"`
+		Unset     *rune `env:"UNSET" envRune:"true" envDefault:"x"`
+	}
+
+	a.setenv("DELIM", ";")
+	a.setenv("ARROW", "→")
+	a.setenv("NUMBER", "59")
+	defer os.Clearenv()
+
+	cfg := &config{}
+	assert.NoError(t, a.run(cfg))
+	assert.Equal(t, ';', cfg.Delimiter)
+	assert.Equal(t, '→', *cfg.Arrow)
+	assert.Equal(t, int32(59), cfg.Number)
+	assert.Equal(t, 'x', *cfg.Unset)
+}
+
+func testInvalidRunes(t *testing.T, a TestAgainst) {
+	type config struct {
+		Delimiter rune `env:"DELIM" envRune:"true"`
+	}
+	defer os.Clearenv()
+
+	var perr *ParseError
+	a.setenv("DELIM", "ab")
+	assert.True(t, errors.As(a.run(&config{}), &perr))
+	assert.EqualError(t, perr.Err, "expected exactly one character, got 2")
+
+	a.setenv("DELIM", "")
+	assert.True(t, errors.As(a.run(&config{}), &perr))
+	assert.EqualError(t, perr.Err, "expected exactly one character, got 0")
+
+	// an unset optional rune stays zero
+	os.Clearenv()
+	cfg := &config{}
+	assert.NoError(t, a.run(cfg))
+	assert.Equal(t, rune(0), cfg.Delimiter)
+}
+
+func testParsesCSV(t *testing.T, a TestAgainst) {
+	type config struct {
+		Names  []string `env:"NAMES" envCSV:"true"`
+		Plain  []string `env:"PLAIN"`
+		Semi   []string `env:"SEMI" envCSV:"true" envSeparator:";"`
+		Quotes []string `env:"QUOTES" envCSV:"true"`
+		Ints   []int    `env:"INTS" envCSV:"true"`
+	}
+
+	a.setenv("NAMES", `"a,b",c`)
+	a.setenv("PLAIN", `"a,b",c`)
+	a.setenv("SEMI", `"x;y";z`)
+	a.setenv("QUOTES", `"say ""hi""",ok`)
+	a.setenv("INTS", `1,"2"`)
+	defer os.Clearenv()
+
+	cfg := &config{}
+	assert.NoError(t, a.run(cfg))
+	assert.Equal(t, []string{"a,b", "c"}, cfg.Names)
+	assert.Equal(t, []string{`"a`, `b"`, "c"}, cfg.Plain)
+	assert.Equal(t, []string{"x;y", "z"}, cfg.Semi)
+	assert.Equal(t, []string{`say "hi"`, "ok"}, cfg.Quotes)
+	assert.Equal(t, []int{1, 2}, cfg.Ints)
+}
+
+func testInvalidCSV(t *testing.T, a TestAgainst) {
+	type config struct {
+		Names []string `env:"NAMES" envCSV:"true"`
+	}
+	defer os.Clearenv()
+
+	a.setenv("NAMES", `"a,b`)
+	err := a.run(&config{})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "into field Names")
+
+	type badSeparator struct {
+		Names []string `env:"NAMES" envCSV:"true" envSeparator:"::"`
+	}
+	a.setenv("NAMES", "a::b")
+	err = a.run(&badSeparator{})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), `envCSV needs a single character separator, got "::"`)
+}
+
+func testParsesEnvSetter(t *testing.T, a TestAgainst) {
+	type config struct {
+		Addr    hostPort  `env:"ADDR"`
+		AddrPtr *hostPort `env:"ADDR_PTR"`
+	}
+
+	a.setenv("ADDR", "localhost:8080")
+	a.setenv("ADDR_PTR", "example.com:443")
+	defer os.Clearenv()
+
+	cfg := &config{}
+	assert.NoError(t, a.run(cfg))
+	assert.Equal(t, hostPort{Host: "localhost", Port: 8080}, cfg.Addr)
+	assert.Equal(t, &hostPort{Host: "example.com", Port: 443}, cfg.AddrPtr)
+
+	a.setenv("ADDR", "localhost")
+	err := a.run(&config{})
+	var perr *ParseError
+	if assert.True(t, errors.As(err, &perr)) {
+		assert.Equal(t, "Addr", perr.Field)
+		assert.Contains(t, perr.Err.Error(), "missing port")
+	}
+
+	a.setenv("ADDR", "localhost:8080")
+	cfg = &config{}
+	err = a.runWithFuncs(cfg, CustomParsers{
+		reflect.TypeOf(hostPort{}): func(v string) (interface{}, error) {
+			return hostPort{Host: "custom"}, nil
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "custom", cfg.Addr.Host)
+}
+
+func testParsesSQLNull(t *testing.T, a TestAgainst) {
+	type config struct {
+		DSN      sql.NullString  `env:"DSN"`
+		MaxConns sql.NullInt64   `env:"MAX_CONNS"`
+		Timeout  sql.NullInt32   `env:"TIMEOUT"`
+		Ratio    sql.NullFloat64 `env:"RATIO" envDefault:"0.5"`
+		Debug    sql.NullBool    `env:"DEBUG"`
+		Since    sql.NullTime    `env:"SINCE" envLayout:"2006-01-02"`
+		Missing  sql.NullString  `env:"MISSING"`
+		Pointer  *sql.NullInt64  `env:"POINTER"`
+	}
+
+	a.setenv("DSN", "postgres://localhost")
+	a.setenv("MAX_CONNS", "10")
+	a.setenv("TIMEOUT", "30")
+	a.setenv("DEBUG", "true")
+	a.setenv("SINCE", "2018-04-05")
+	a.setenv("POINTER", "7")
+	defer os.Clearenv()
+
+	cfg := &config{}
+	assert.NoError(t, a.run(cfg))
+	assert.Equal(t, sql.NullString{String: "postgres://localhost", Valid: true}, cfg.DSN)
+	assert.Equal(t, sql.NullInt64{Int64: 10, Valid: true}, cfg.MaxConns)
+	assert.Equal(t, sql.NullInt32{Int32: 30, Valid: true}, cfg.Timeout)
+	assert.Equal(t, sql.NullFloat64{Float64: 0.5, Valid: true}, cfg.Ratio)
+	assert.Equal(t, sql.NullBool{Bool: true, Valid: true}, cfg.Debug)
+	assert.Equal(t, sql.NullTime{Time: time.Date(2018, 4, 5, 0, 0, 0, 0, time.UTC), Valid: true}, cfg.Since)
+	assert.Equal(t, sql.NullString{}, cfg.Missing)
+	assert.Equal(t, &sql.NullInt64{Int64: 7, Valid: true}, cfg.Pointer)
+}
+
+func testInvalidSQLNull(t *testing.T, a TestAgainst) {
+	type config struct {
+		MaxConns sql.NullInt64 `env:"MAX_CONNS"`
+	}
+
+	a.setenv("MAX_CONNS", "ten")
+	defer os.Clearenv()
+
+	cfg := &config{}
+	err := a.run(cfg)
+	var perr *ParseError
+	if assert.True(t, errors.As(err, &perr)) {
+		assert.Equal(t, "MaxConns", perr.Field)
+	}
+	assert.False(t, cfg.MaxConns.Valid)
+}
+
+func testParsesMultiCharSeparators(t *testing.T, a TestAgainst) {
+	type config struct {
+		Pipes  []string          `env:"PIPES" envSeparator:"||"`
+		Spaced []int             `env:"SPACED" envSeparator:", "`
+		Labels map[string]string `env:"LABELS" envSeparator:";;" envKeyValSeparator:"=>"`
+	}
+
+	a.setenv("PIPES", "a|b||c")
+	a.setenv("SPACED", "1, 2, 3")
+	a.setenv("LABELS", "app=>web;;tier=>front")
+	defer os.Clearenv()
+
+	cfg := &config{}
+	assert.NoError(t, a.run(cfg))
+	assert.Equal(t, []string{"a|b", "c"}, cfg.Pipes)
+	assert.Equal(t, []int{1, 2, 3}, cfg.Spaced)
+	assert.Equal(t, map[string]string{"app": "web", "tier": "front"}, cfg.Labels)
+}
+
+func testParsesLines(t *testing.T, a TestAgainst) {
+	type config struct {
+		Hosts  []string          `env:"HOSTS" envSeparator:"\n" envOmitEmpty:"true"`
+		Raw    []string          `env:"RAW" envSeparator:"\n"`
+		Ports  []int             `env:"PORTS" envSeparator:"\n"`
+		Fields []string          `env:"FIELDS" envSeparator:"\t"`
+		Labels map[string]string `env:"LABELS" envSeparator:"\n" envKeyValSeparator:"="`
+	}
+
+	a.setenv("HOSTS", "a.example.com\r\nb.example.com\r\n")
+	a.setenv("RAW", "a\nb\n")
+	a.setenv("PORTS", "80\r\n443\n")
+	a.setenv("FIELDS", "a\tb c")
+	a.setenv("LABELS", "app=web\r\ntier=front")
+	defer os.Clearenv()
+
+	cfg := &config{}
+	assert.NoError(t, a.run(cfg))
+	assert.Equal(t, []string{"a.example.com", "b.example.com"}, cfg.Hosts)
+	assert.Equal(t, []string{"a", "b", ""}, cfg.Raw)
+	assert.Equal(t, []int{80, 443}, cfg.Ports)
+	assert.Equal(t, []string{"a", "b c"}, cfg.Fields)
+	assert.Equal(t, map[string]string{"app": "web", "tier": "front"}, cfg.Labels)
+}
+
+func testParsesQuotedMaps(t *testing.T, a TestAgainst) {
+	type config struct {
+		Labels  map[string]string   `env:"LABELS" envCSV:"true" envKeyValSeparator:"="`
+		Ports   map[string]int      `env:"PORTS" envCSV:"true" envSeparator:";"`
+		Headers map[string][]string `env:"HEADERS" envCSV:"true"`
+	}
+
+	a.setenv("LABELS", `"hosts=a,b",tier=front,"note=say ""hi"""`)
+	a.setenv("PORTS", `http:80;"https:443"`)
+	a.setenv("HEADERS", `"accept:text/html,application/json",accept:*/*`)
+	defer os.Clearenv()
+
+	cfg := &config{}
+	assert.NoError(t, a.run(cfg))
+	assert.Equal(t, map[string]string{"hosts": "a,b", "tier": "front", "note": `say "hi"`}, cfg.Labels)
+	assert.Equal(t, map[string]int{"http": 80, "https": 443}, cfg.Ports)
+	assert.Equal(t, map[string][]string{"accept": {"text/html,application/json", "*/*"}}, cfg.Headers)
+
+	a.setenv("LABELS", `"hosts=a,b`)
+	assert.Error(t, a.run(&config{}))
+}
+
+func testInvalidSeparators(t *testing.T, a TestAgainst) {
+	type config struct {
+		Hosts []string `env:"HOSTS" envSeparator:""`
+	}
+	type mapConfig struct {
+		Labels map[string]string `env:"LABELS" envKeyValSeparator:""`
+	}
+
+	a.setenv("HOSTS", "a,b")
+	defer os.Clearenv()
+
+	assert.EqualError(t, a.run(&config{}), "Tag envSeparator of field Hosts must not be empty")
+	assert.EqualError(t, a.run(&mapConfig{}), "Tag envKeyValSeparator of field Labels must not be empty")
+}
+
+func testParsesOmitEmpty(t *testing.T, a TestAgainst) {
+	type config struct {
+		Ints      []int           `env:"INTS"`
+		Durations []time.Duration `env:"DURATIONS" envTrim:"true"`
+		Strings   []string        `env:"STRINGS"`
+		Bools     []bool          `env:"BOOLS"`
+		OmitBools []bool          `env:"OMIT_BOOLS" envOmitEmpty:"true"`
+		Omitted   []string        `env:"OMITTED" envOmitEmpty:"true"`
+		Spaces    []string        `env:"SPACES" envOmitEmpty:"true"`
+		Trimmed   []string        `env:"TRIMMED" envOmitEmpty:"true" envTrim:"true"`
+	}
+
+	a.setenv("INTS", "1,,2,")
+	a.setenv("DURATIONS", "1s, ,2s")
+	a.setenv("STRINGS", "a,,b,")
+	a.setenv("BOOLS", "true,false")
+	a.setenv("OMIT_BOOLS", "true,,false,")
+	a.setenv("OMITTED", ",a,,b,")
+	a.setenv("SPACES", "a, ,b")
+	a.setenv("TRIMMED", "a, ,b")
+	defer os.Clearenv()
+
+	cfg := &config{}
+	assert.NoError(t, a.run(cfg))
+	assert.Equal(t, []int{1, 2}, cfg.Ints)
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second}, cfg.Durations)
+	assert.Equal(t, []string{"a", "", "b", ""}, cfg.Strings)
+	assert.Equal(t, []bool{true, false}, cfg.Bools)
+	assert.Equal(t, []bool{true, false}, cfg.OmitBools)
+	assert.Equal(t, []string{"a", "b"}, cfg.Omitted)
+	assert.Equal(t, []string{"a", " ", "b"}, cfg.Spaces)
+	assert.Equal(t, []string{"a", "b"}, cfg.Trimmed)
+
+	// only numeric slices drop empty elements by default
+	a.setenv("BOOLS", "true,,false")
+	assert.Error(t, a.run(&config{}))
+}
+
+func testParsesDefaultOnEmpty(t *testing.T, a TestAgainst) {
+	type config struct {
+		Empty   string `env:"EMPTY" envDefault:"default" envDefaultOnEmpty:"true"`
+		Blank   int    `env:"BLANK" envDefault:"42" envDefaultOnEmpty:"true" envTrim:"true"`
+		Set     string `env:"SET" envDefault:"default" envDefaultOnEmpty:"true"`
+		Unset   string `env:"UNSET" envDefault:"default" envDefaultOnEmpty:"true"`
+		Keep    string `env:"KEEP" envDefault:"default"`
+		Spaces  string `env:"SPACES" envDefault:"default" envDefaultOnEmpty:"true"`
+		Missing string `env:"MISSING,required" envDefaultOnEmpty:"true"`
+	}
+
+	a.setenv("EMPTY", "")
+	a.setenv("BLANK", "   ")
+	a.setenv("SET", "value")
+	a.setenv("KEEP", "")
+	a.setenv("SPACES", "  ")
+	a.setenv("MISSING", "x")
+	defer os.Clearenv()
+
+	cfg := &config{}
+	assert.NoError(t, a.run(cfg))
+	assert.Equal(t, &config{
+		Empty:   "default",
+		Blank:   42,
+		Set:     "value",
+		Unset:   "default",
+		Spaces:  "  ",
+		Missing: "x",
+	}, cfg)
+
+	a.setenv("MISSING", "")
+	err := a.run(&config{})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "MISSING is not set")
+}
+
+func testParsesByteSizes(t *testing.T, a TestAgainst) {
+	type config struct {
+		MaxBody  int64  `env:"MAX_BODY" envBytes:"true"`
+		Buffer   uint32 `env:"BUFFER" envBytes:"true"`
+		Plain    int    `env:"PLAIN" envBytes:"true"`
+		Lower    uint64 `env:"LOWER" envBytes:"true"`
+		Default  *int64 `env:"DEFAULT" envBytes:"true" envDefault:"2GiB"`
+		Untagged int    `env:"UNTAGGED"`
+	}
+
+	a.setenv("MAX_BODY", "10MB")
+	a.setenv("BUFFER", "64KiB")
+	a.setenv("PLAIN", "512")
+	a.setenv("LOWER", "3 gb")
+	a.setenv("UNTAGGED", "8")
+	defer os.Clearenv()
+
+	cfg := &config{}
+	assert.NoError(t, a.run(cfg))
+	assert.Equal(t, int64(10000000), cfg.MaxBody)
+	assert.Equal(t, uint32(65536), cfg.Buffer)
+	assert.Equal(t, 512, cfg.Plain)
+	assert.Equal(t, uint64(3000000000), cfg.Lower)
+	assert.Equal(t, int64(2<<30), *cfg.Default)
+	assert.Equal(t, 8, cfg.Untagged)
+}
+
+func testInvalidByteSizes(t *testing.T, a TestAgainst) {
+	type config struct {
+		Size int64 `env:"SIZE" envBytes:"true"`
+	}
+	type small struct {
+		Size uint8 `env:"SIZE" envBytes:"true"`
+	}
+	defer os.Clearenv()
+
+	for _, value := range []string{"10XB", "MB", "-1KB", "1.5GB", "20000000TB"} {
+		a.setenv("SIZE", value)
+		err := a.run(&config{})
+		var perr *ParseError
+		if assert.True(t, errors.As(err, &perr), value) {
+			assert.Equal(t, "Size", perr.Field)
+			assert.Equal(t, value, perr.Value)
+		}
+	}
+
+	a.setenv("SIZE", "1KB")
+	assert.Error(t, a.run(&small{}))
+}
+
+func testTrimsNumericSlices(t *testing.T, a TestAgainst) {
+	type config struct {
+		Numbers   []int           `env:"NUMBERS"`
+		Floats    []float64       `env:"FLOATS"`
+		Durations []time.Duration `env:"DURATIONS"`
+		Sized     [2]int8         `env:"SIZED"`
+		Strings   []string        `env:"STRINGS"`
+	}
+
+	a.setenv("NUMBERS", "1, 2 ,3")
+	a.setenv("FLOATS", " 1.5,\t2")
+	a.setenv("DURATIONS", "1s, 2m")
+	a.setenv("SIZED", "1, 2")
+	a.setenv("STRINGS", "a, b")
+	defer os.Clearenv()
+
+	cfg := &config{}
+	assert.NoError(t, a.run(cfg))
+	assert.Equal(t, []int{1, 2, 3}, cfg.Numbers)
+	assert.Equal(t, []float64{1.5, 2}, cfg.Floats)
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Minute}, cfg.Durations)
+	assert.Equal(t, [2]int8{1, 2}, cfg.Sized)
+	assert.Equal(t, []string{"a", " b"}, cfg.Strings)
+}
+
+func testParsesPresence(t *testing.T, a TestAgainst) {
+	type config struct {
+		Verbose bool  `env:"VERBOSE" envPresence:"true"`
+		Quiet   bool  `env:"QUIET" envPresence:"true"`
+		Debug   bool  `env:"DEBUG" envPresence:"true" envDefault:"true"`
+		Trace   *bool `env:"TRACE" envPresence:"true"`
+		Plain   bool  `env:"PLAIN"`
+	}
+	type badConfig struct {
+		Level int `env:"LEVEL" envPresence:"true"`
+	}
+
+	a.setenv("VERBOSE", "")
+	a.setenv("TRACE", "false")
+	a.setenv("PLAIN", "false")
+	defer os.Clearenv()
+
+	cfg := &config{Quiet: true}
+	assert.NoError(t, a.run(cfg))
+	assert.True(t, cfg.Verbose)
+	assert.False(t, cfg.Quiet)
+	assert.False(t, cfg.Debug)
+	assert.True(t, *cfg.Trace)
+	assert.False(t, cfg.Plain)
+
+	err := a.run(&badConfig{})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "envPresence")
+
+	// required and notEmpty check the raw value, then presence applies
+	type required struct {
+		Verbose bool `env:"VERBOSE,required" envPresence:"true"`
+		Loud    bool `env:"LOUD,notEmpty" envPresence:"true"`
+	}
+	a.setenv("VERBOSE", "yes")
+	a.setenv("LOUD", "yes")
+	req := &required{}
+	assert.NoError(t, a.run(req))
+	assert.True(t, req.Verbose)
+	assert.True(t, req.Loud)
+
+	a.setenv("VERBOSE", "")
+	req = &required{}
+	assert.NoError(t, a.run(req))
+	assert.True(t, req.Verbose)
+
+	a.setenv("LOUD", "")
+	assert.Error(t, a.run(&required{}))
+}
+
+func testParsesPercent(t *testing.T, a TestAgainst) {
+	type config struct {
+		Threshold float64  `env:"THRESHOLD" envPercent:"true"`
+		Plain     float64  `env:"PLAIN" envPercent:"true"`
+		Small     float32  `env:"SMALL" envPercent:"true"`
+		Default   *float64 `env:"DEFAULT" envPercent:"true" envDefault:"12.5%"`
+	}
+
+	a.setenv("THRESHOLD", "75%")
+	a.setenv("PLAIN", "0.3")
+	a.setenv("SMALL", "50%")
+	defer os.Clearenv()
+
+	cfg := &config{}
+	assert.NoError(t, a.run(cfg))
+	assert.Equal(t, 0.75, cfg.Threshold)
+	assert.Equal(t, 0.3, cfg.Plain)
+	assert.Equal(t, float32(0.5), cfg.Small)
+	assert.Equal(t, 0.125, *cfg.Default)
+}
+
+func testInvalidPercent(t *testing.T, a TestAgainst) {
+	type config struct {
+		Threshold float64 `env:"THRESHOLD" envPercent:"true"`
+	}
+	type noPercent struct {
+		Threshold float64 `env:"THRESHOLD"`
+	}
+	defer os.Clearenv()
+
+	for _, value := range []string{"%", "75%%", "abc%", "7 5%"} {
+		a.setenv("THRESHOLD", value)
+		assert.Error(t, a.run(&config{}), value)
+	}
+
+	a.setenv("THRESHOLD", "75%")
+	assert.Error(t, a.run(&noPercent{}))
+}
+
+func testParsesArrays(t *testing.T, a TestAgainst) {
+	type config struct {
+		IPs     [3]string        `env:"IPS"`
+		Ports   [2]int           `env:"PORTS" envSeparator:":"`
+		Times   [2]time.Duration `env:"TIMES" envDefault:"1s,2s"`
+		Key     [2]byte          `env:"KEY" envEncoding:"hex"`
+		Nothing [0]int           `env:"NOTHING"`
+	}
+
+	a.setenv("IPS", "10.0.0.1,10.0.0.2,10.0.0.3")
+	a.setenv("PORTS", "80:443")
+	a.setenv("KEY", "beef")
+	defer os.Clearenv()
+
+	cfg := config{}
+	assert.NoError(t, a.run(&cfg))
+	assert.Equal(t, [3]string{"10.0.0.1", "10.0.0.2", "10.0.0.3"}, cfg.IPs)
+	assert.Equal(t, [2]int{80, 443}, cfg.Ports)
+	assert.Equal(t, [2]time.Duration{time.Second, 2 * time.Second}, cfg.Times)
+	assert.Equal(t, [2]byte{0xbe, 0xef}, cfg.Key)
+}
+
+func testInvalidArrays(t *testing.T, a TestAgainst) {
+	type config struct {
+		IPs [3]string `env:"IPS"`
+	}
+	defer os.Clearenv()
+
+	var perr *ParseError
+	a.setenv("IPS", "a,b")
+	err := a.run(&config{})
+	assert.True(t, errors.As(err, &perr))
+	assert.EqualError(t, perr.Err, "expected 3 elements, got 2")
+
+	a.setenv("IPS", "")
+	err = a.run(&config{})
+	assert.True(t, errors.As(err, &perr))
+	assert.EqualError(t, perr.Err, "expected 3 elements, got 0")
+
+	type ints struct {
+		Numbers [2]int `env:"NUMBERS"`
+	}
+	a.setenv("NUMBERS", "1,x")
+	err = a.run(&ints{})
+	assert.Error(t, err)
+}
+
+func testParsesStructSlice(t *testing.T, a TestAgainst) {
+	type server struct {
+		Host string `env:"HOST"`
+		Port int    `env:"PORT" envDefault:"80"`
+	}
+	type config struct {
+		Servers []server `envPrefix:"SERVER"`
+		Others  []server `envPrefix:"OTHER"`
+	}
+
+	a.setenv("SERVER_0_HOST", "a.example.com")
+	a.setenv("SERVER_0_PORT", "8080")
+	a.setenv("SERVER_1_HOST", "b.example.com")
+	a.setenv("SERVER_3_HOST", "unreachable.example.com")
+	defer os.Clearenv()
+
+	cfg := &config{}
+	assert.NoError(t, a.run(cfg))
+	assert.Equal(t, []server{
+		{Host: "a.example.com", Port: 8080},
+		{Host: "b.example.com", Port: 80},
+	}, cfg.Servers)
+	assert.Nil(t, cfg.Others)
+
+	a.setenv("SERVER_1_PORT", "not-a-port")
+	assert.Error(t, a.run(&config{}))
+}
+
+func testParsesStructMap(t *testing.T, a TestAgainst) {
+	type tls struct {
+		Cert string `env:"CERT"`
+	}
+	type backend struct {
+		Host string `env:"HOST,required"`
+		Port int    `env:"PORT" envDefault:"80"`
+		TLS  tls    `envPrefix:"TLS_"`
+	}
+	type config struct {
+		Backends map[string]backend `envPrefix:"BACKENDS"`
+		Others   map[string]backend `envPrefix:"OTHERS"`
+	}
+
+	a.setenv("BACKENDS_PRIMARY_HOST", "a.example.com")
+	a.setenv("BACKENDS_PRIMARY_PORT", "8080")
+	a.setenv("BACKENDS_EU_WEST_HOST", "b.example.com")
+	a.setenv("BACKENDS_CACHE_TLS_CERT", "cert.pem")
+	a.setenv("BACKENDS_UNKNOWN", "ignored")
+	defer os.Clearenv()
+
+	cfg := &config{}
+	err := a.run(cfg)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "BACKENDS_CACHE_HOST")
+
+	a.setenv("BACKENDS_CACHE_HOST", "c.example.com")
+	cfg = &config{}
+	assert.NoError(t, a.run(cfg))
+	assert.Equal(t, map[string]backend{
+		"primary": {Host: "a.example.com", Port: 8080},
+		"eu_west": {Host: "b.example.com", Port: 80},
+		"cache":   {Host: "c.example.com", Port: 80, TLS: tls{Cert: "cert.pem"}},
+	}, cfg.Backends)
+	assert.Nil(t, cfg.Others)
+
+	err = ParseWithOptions(&config{}, Options{Source: MapSource(map[string]string{})})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Backends")
+
+	// PORT is a suffix of ADMIN_PORT, which must not make an element X_ADMIN
+	type ports struct {
+		Port      int `env:"PORT"`
+		AdminPort int `env:"ADMIN_PORT"`
+	}
+	type suffixes struct {
+		B map[string]ports `envPrefix:"B"`
+	}
+	os.Clearenv()
+	a.setenv("B_X_ADMIN_PORT", "1")
+	sfx := &suffixes{}
+	assert.NoError(t, a.run(sfx))
+	assert.Equal(t, map[string]ports{"x": {AdminPort: 1}}, sfx.B)
+}
+
+func testParsesFile(t *testing.T, a TestAgainst) {
+	type config struct {
+		Token  string `env:"TOKEN,required" envFile:"true"`
+		Direct string `env:"DIRECT" envFile:"true"`
+		NoFile string `env:"NOFILE"`
+	}
+
+	f, err := ioutil.TempFile("", "env")
+	assert.NoError(t, err)
+	defer os.Remove(f.Name())
+	f.WriteString("s3cr3t\n")
+	f.Close()
+
+	a.setenv("TOKEN_FILE", f.Name())
+	a.setenv("DIRECT", "direct")
+	a.setenv("DIRECT_FILE", f.Name())
+	a.setenv("NOFILE_FILE", f.Name())
+	defer os.Clearenv()
+
+	cfg := &config{}
+	assert.NoError(t, a.run(cfg))
+	assert.Equal(t, "s3cr3t", cfg.Token)
+	assert.Equal(t, "direct", cfg.Direct)
+	assert.Equal(t, "", cfg.NoFile)
+
+	a.setenv("TOKEN_FILE", f.Name()+".missing")
+	err = a.run(&config{})
+	var perr *ParseError
+	if assert.True(t, errors.As(err, &perr)) {
+		assert.Equal(t, "Token", perr.Field)
+	}
+}
+
+func testParsesExpand(t *testing.T, a TestAgainst) {
+	type config struct {
+		LogDir    string `env:"LOG_DIR" envExpand:"true"`
+		Undefined string `env:"UNDEFINED" envExpand:"true"`
+		Raw       string `env:"RAW"`
+		Port      int    `env:"PORT" envExpand:"true"`
+	}
+
+	os.Setenv("HOME", "/tmp/fakehome")
+	os.Setenv("BASE_PORT", "8080")
+	a.setenv("LOG_DIR", "${HOME}/logs")
+	a.setenv("UNDEFINED", "${NOT_DEFINED}/logs")
+	a.setenv("RAW", "${HOME}/logs")
+	a.setenv("PORT", "$BASE_PORT")
+	defer os.Clearenv()
+
+	cfg := &config{}
+	assert.NoError(t, a.run(cfg))
+	assert.Equal(t, "/tmp/fakehome/logs", cfg.LogDir)
+	assert.Equal(t, "/logs", cfg.Undefined)
+	assert.Equal(t, "${HOME}/logs", cfg.Raw)
+	assert.Equal(t, 8080, cfg.Port)
+}
+
+func testExpandsDefaults(t *testing.T, a TestAgainst) {
+	type config struct {
+		CacheDir  string `env:"CACHE_DIR" envExpand:"true" envDefault:"${DATA_DIR}/cache"`
+		LogDir    string `env:"LOG_DIR" envDefault:"$DATA_DIR/logs"`
+		Undefined string `env:"UNDEFINED" envExpand:"true" envDefault:"${NOT_DEFINED}/tmp"`
+		Price     string `env:"PRICE" envExpand:"true" envDefault:"$$5"`
+		Pattern   string `env:"PATTERN" envDefault:"^[a-z]+$"`
+		Expanded  string `env:"EXPANDED" envExpand:"true" envDefault:"${DATA_DIR}/x"`
+		Password  string `env:"PASSWORD" envDefault:"pa$word"`
+		Raw       string `env:"RAW" envDefault:"${DATA_DIR}/raw"`
+	}
+
+	os.Setenv("DATA_DIR", "/data")
+	os.Setenv("PREFIX_DATA_DIR", "/data")
+	a.setenv("LOG_DIR", "$DATA_DIR/mine")
+	a.setenv("EXPANDED", "${DATA_DIR}/y")
+	defer os.Clearenv()
+
+	cfg := &config{}
+	assert.NoError(t, a.run(cfg))
+	assert.Equal(t, "/data/cache", cfg.CacheDir)
+	assert.Equal(t, "$DATA_DIR/mine", cfg.LogDir)
+	assert.Equal(t, "/tmp", cfg.Undefined)
+	assert.Equal(t, "$5", cfg.Price)
+	assert.Equal(t, "^[a-z]+$", cfg.Pattern)
+	assert.Equal(t, "/data/y", cfg.Expanded)
+	// without envExpand, defaults are used as is
+	assert.Equal(t, "pa$word", cfg.Password)
+	assert.Equal(t, "${DATA_DIR}/raw", cfg.Raw)
+}
+
+func testSkipsDashTag(t *testing.T, a TestAgainst) {
+	type inner struct {
+		Host string `env:"HOST"`
+	}
+	type config struct {
+		Name    string  `env:"NAME"`
+		Ignored string  `env:"-"`
+		Nested  inner   `env:"-"`
+		Ptr     *inner  `env:"-"`
+		Servers []inner `env:"-" envPrefix:"SERVER"`
+	}
+
+	a.setenv("NAME", "name")
+	a.setenv("-", "dash")
+	a.setenv("HOST", "host")
+	a.setenv("SERVER_0_HOST", "host")
+	defer os.Clearenv()
+
+	cfg := &config{Ignored: "kept", Ptr: &inner{Host: "kept"}}
+	assert.NoError(t, a.run(cfg))
+	assert.Equal(t, "name", cfg.Name)
+	assert.Equal(t, "kept", cfg.Ignored)
+	assert.Equal(t, "", cfg.Nested.Host)
+	assert.Equal(t, "kept", cfg.Ptr.Host)
+	assert.Nil(t, cfg.Servers)
+
+	infos, err := Keys(cfg)
+	assert.NoError(t, err)
+	assert.Len(t, infos, 1)
+
+	ret, err := Marshal(cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"NAME": "name"}, ret)
+}
+
+func testParsesTrim(t *testing.T, a TestAgainst) {
+	type config struct {
+		Port    int      `env:"PORT" envTrim:"true"`
+		Name    string   `env:"NAME" envTrim:"true" envExpand:"true"`
+		Hosts   []string `env:"HOSTS" envTrim:"true"`
+		Numbers []int    `env:"NUMBERS" envTrim:"true"`
+		Raw     string   `env:"RAW"`
+	}
+	type notEmptyConfig struct {
+		Token string `env:"TOKEN,notEmpty" envTrim:"true"`
+	}
+
+	os.Setenv("NAME_VALUE", " name ")
+	a.setenv("PORT", " 8080\n")
+	a.setenv("NAME", "${NAME_VALUE}")
+	a.setenv("HOSTS", " a , b ")
+	a.setenv("NUMBERS", "1, 2 ,3")
+	a.setenv("RAW", " raw ")
+	a.setenv("TOKEN", "  ")
+	defer os.Clearenv()
+
+	cfg := &config{}
+	assert.NoError(t, a.run(cfg))
+	assert.Equal(t, 8080, cfg.Port)
+	assert.Equal(t, "name", cfg.Name)
+	assert.Equal(t, []string{"a", "b"}, cfg.Hosts)
+	assert.Equal(t, []int{1, 2, 3}, cfg.Numbers)
+	assert.Equal(t, " raw ", cfg.Raw)
+
+	err := a.run(&notEmptyConfig{})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "is set but empty")
+}
+
+func testParsesAliases(t *testing.T, a TestAgainst) {
+	type config struct {
+		Name   string `env:"NEW_NAME" envAliases:"OLD_NAME,LEGACY"`
+		Port   int    `env:"PORT" envAliases:"OLD_PORT"`
+		Secret string `env:"SECRET,required" envAliases:"OLD_SECRET"`
+	}
+
+	a.setenv("OLD_NAME", "old")
+	a.setenv("LEGACY", "legacy")
+	a.setenv("OLD_SECRET", "s3cr3t")
+	defer os.Clearenv()
+
+	cfg := &config{}
+	assert.NoError(t, a.run(cfg))
+	assert.Equal(t, "old", cfg.Name)
+	assert.Equal(t, "s3cr3t", cfg.Secret)
+
+	a.setenv("NEW_NAME", "new")
+	assert.NoError(t, a.run(cfg))
+	assert.Equal(t, "new", cfg.Name)
+
+	a.setenv("OLD_PORT", "not-a-port")
+	err := a.run(&config{})
+	var perr *ParseError
+	if assert.True(t, errors.As(err, &perr)) {
+		assert.Contains(t, perr.Key, "OLD_PORT")
+	}
+}
+
+func testParseErrorDetails(t *testing.T, a TestAgainst) {
+	a.setenv("PORT", "should-be-an-int")
+	defer os.Clearenv()
+
+	err := a.run(&Config{})
+	var perr *ParseError
+	if assert.True(t, errors.As(err, &perr)) {
+		assert.Equal(t, "Port", perr.Field)
+		assert.Contains(t, perr.Key, "PORT")
+		assert.Equal(t, "should-be-an-int", perr.Value)
+		assert.NotNil(t, errors.Unwrap(err))
+	}
+}
+
+func TestMustParse(t *testing.T) {
+	type config struct {
+		Port   int    `env:"PORT"`
+		Secret string `env:"SECRET,required"`
+	}
+
+	os.Setenv("PORT", "8080")
+	os.Setenv("PREFIX_SECRET", "s3cr3t")
+	defer os.Clearenv()
+
+	assert.PanicsWithValue(t, ErrNotAStructPtr, func() {
+		MustParse(config{})
+	})
+	assert.Panics(t, func() {
+		MustParse(&config{})
+	})
+
+	cfg := &config{}
+	assert.NotPanics(t, func() {
+		MustParseWithPrefix(cfg, "PREFIX_")
+	})
+	assert.Equal(t, "s3cr3t", cfg.Secret)
+}
+
+func TestParseWithOptionsRequiredIfNoDef(t *testing.T) {
+	type config struct {
+		Home     string `env:"HOME"`
+		Port     int    `env:"PORT" envDefault:"3000"`
+		Debug    bool   `env:"DEBUG,optional"`
+		NotAnEnv string
+		Inner    *InnerStruct
+	}
+
+	opts := Options{RequiredIfNoDef: true}
+	os.Setenv("innervar", "inner")
+	os.Setenv("innernum", "1")
+	defer os.Clearenv()
+
+	err := ParseWithOptions(&config{}, opts)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "HOME")
+
+	os.Setenv("HOME", "/tmp/fakehome")
+	cfg := &config{Inner: &InnerStruct{}}
+	assert.NoError(t, ParseWithOptions(cfg, opts))
+	assert.Equal(t, "/tmp/fakehome", cfg.Home)
+	assert.Equal(t, 3000, cfg.Port)
+	assert.Equal(t, false, cfg.Debug)
+	assert.Equal(t, "inner", cfg.Inner.Inner)
+}
+
+func TestParseWithOptionsOnSet(t *testing.T) {
+	type config struct {
+		Home   string `env:"HOME"`
+		Port   int    `env:"PORT" envDefault:"3000"`
+		Unset  string `env:"UNSET"`
+		Broken int    `env:"BROKEN"`
+	}
+
+	os.Setenv("HOME", "/tmp/fakehome")
+	os.Setenv("BROKEN", "not-an-int")
+	defer os.Clearenv()
+
+	var calls []string
+	opts := Options{
+		OnSet: func(field, key, value string, fromDefault bool) {
+			calls = append(calls, fmt.Sprintf("%s %s=%s %v", field, key, value, fromDefault))
+		},
+	}
+	cfg := &config{}
+	assert.Error(t, ParseWithOptions(cfg, opts))
+	assert.Equal(t, []string{
+		"Home HOME=/tmp/fakehome false",
+		"Port PORT=3000 true",
+	}, calls)
+	assert.Equal(t, "/tmp/fakehome", cfg.Home)
+	assert.Equal(t, 3000, cfg.Port)
+}
+
+func TestParseWithOptionsOnDefault(t *testing.T) {
+	type config struct {
+		Home   string `env:"HOME" envDefault:"/root"`
+		Port   int    `env:"PORT" envDefault:"3000"`
+		Unset  string `env:"UNSET"`
+		Broken int    `env:"BROKEN" envDefault:"not-an-int"`
+	}
+
+	os.Setenv("HOME", "/tmp/fakehome")
+	defer os.Clearenv()
+
+	var calls []string
+	opts := Options{
+		OnDefault: func(field, key, value string) {
+			calls = append(calls, "default "+field+" "+key+"="+value)
+		},
+		OnSet: func(field, key, value string, fromDefault bool) {
+			calls = append(calls, "set "+field)
+		},
+	}
+	cfg := &config{}
+	assert.Error(t, ParseWithOptions(cfg, opts))
+	assert.Equal(t, []string{
+		"set Home",
+		"default Port PORT=3000",
+		"set Port",
+	}, calls)
+	assert.Equal(t, 3000, cfg.Port)
+}
+
+func TestParseWithOptionsOnDeprecated(t *testing.T) {
+	type config struct {
+		Name    string `env:"NEW_NAME" envAliases:"OLD_NAME"`
+		OldName string `env:"OLD_NAME" envDeprecated:"use NEW_NAME instead"`
+		Unset   string `env:"UNSET" envDeprecated:"not used anymore"`
+	}
+
+	os.Setenv("OLD_NAME", "old")
+	defer os.Clearenv()
+
+	var warnings []string
+	cfg := &config{}
+	assert.NoError(t, ParseWithOptions(cfg, Options{
+		OnDeprecated: func(key, message string) {
+			warnings = append(warnings, key+": "+message)
+		},
+	}))
+	assert.Equal(t, "old", cfg.Name)
+	assert.Equal(t, "old", cfg.OldName)
+	assert.Equal(t, []string{"OLD_NAME: use NEW_NAME instead"}, warnings)
+}
+
+func TestParseConcurrent(t *testing.T) {
+	type foobar struct {
+		name string
+	}
+	type config struct {
+		Home    string        `env:"HOME,required"`
+		Port    int           `env:"PORT" envMin:"1"`
+		Name    string        `env:"NAME" envMatch:"^[a-z]+$"`
+		Bar     foobar        `env:"BAR"`
+		Inner   *InnerStruct  `envPrefix:"INNER_"`
+		Servers []InnerStruct `envPrefix:"SERVER"`
+	}
+
+	os.Setenv("HOME", "/home/me")
+	os.Setenv("PORT", "8080")
+	os.Setenv("NAME", "env")
+	os.Setenv("BAR", "bar")
+	os.Setenv("INNER_innervar", "inner")
+	os.Setenv("SERVER_0_innervar", "server")
+	defer os.Clearenv()
+
+	parsers := CustomParsers{
+		reflect.TypeOf(foobar{}): func(v string) (interface{}, error) {
+			return foobar{name: v}, nil
+		},
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cfg := config{Inner: &InnerStruct{}}
+			assert.NoError(t, ParseWithFuncs(&cfg, parsers))
+			assert.Equal(t, "/home/me", cfg.Home)
+			assert.Equal(t, 8080, cfg.Port)
+			assert.Equal(t, "bar", cfg.Bar.name)
+			assert.Equal(t, "inner", cfg.Inner.Inner)
+			assert.Equal(t, "server", cfg.Servers[0].Inner)
+		}()
+	}
+	wg.Wait()
+}
+
+func TestParseWithSource(t *testing.T) {
+	type config struct {
+		Home     string `env:"HOME"`
+		Port     int    `env:"PORT" envDefault:"3000"`
+		Secret   string `env:"SECRET,required"`
+		Database string `env:"DATABASE_URL"`
+		Inner    *InnerStruct
+	}
+
+	os.Setenv("DATABASE_URL", "from-os")
+	defer os.Clearenv()
+
+	source := MapSource(map[string]string{
+		"HOME":     "/tmp/fakehome",
+		"SECRET":   "s3cr3t",
+		"innervar": "inner",
+	})
+
+	cfg := &config{Inner: &InnerStruct{}}
+	assert.NoError(t, ParseWithSource(cfg, source))
+	assert.Equal(t, "/tmp/fakehome", cfg.Home)
+	assert.Equal(t, 3000, cfg.Port)
+	assert.Equal(t, "s3cr3t", cfg.Secret)
+	assert.Equal(t, "", cfg.Database)
+	assert.Equal(t, "inner", cfg.Inner.Inner)
+
+	err := ParseWithSource(&config{}, MapSource(nil))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "SECRET")
+}
+
+func TestParseWithOptionsCaseInsensitive(t *testing.T) {
+	type config struct {
+		Home string `env:"HOME"`
+		Port int    `env:"PORT"`
+		Path string `env:"PATH"`
+	}
+
+	os.Setenv("home", "/tmp/fakehome")
+	os.Setenv("Port", "8080")
+	defer os.Clearenv()
+
+	cfg := &config{}
+	assert.NoError(t, ParseWithOptions(cfg, Options{CaseInsensitive: true}))
+	assert.Equal(t, "/tmp/fakehome", cfg.Home)
+	assert.Equal(t, 8080, cfg.Port)
+
+	m := map[string]string{"Path": "/b", "path": "/a", "pATH": "/c"}
+	cfg = &config{}
+	assert.NoError(t, ParseWithOptions(cfg, Options{
+		Source:          MapSource(m),
+		SourceKeys:      MapSourceKeys(m),
+		CaseInsensitive: true,
+	}))
+	assert.Equal(t, "/b", cfg.Path)
+
+	cfg = &config{}
+	assert.NoError(t, ParseWithOptions(cfg, Options{
+		Source:          MapSource(m),
+		CaseInsensitive: true,
+	}))
+	assert.Equal(t, "", cfg.Path)
+}
+
+func TestParseWithOptionsCollectAllErrors(t *testing.T) {
+	type config struct {
+		Port     int           `env:"PORT"`
+		Duration time.Duration `env:"DURATION"`
+		Secret   string        `env:"SECRET,required"`
+		Inner    *InnerStruct
+	}
+
+	os.Setenv("PORT", "should-be-an-int")
+	os.Setenv("DURATION", "should-be-a-duration")
+	os.Setenv("innernum", "-547")
+	defer os.Clearenv()
+
+	cfg := &config{Inner: &InnerStruct{}}
+	err := ParseWithOptions(cfg, Options{CollectAllErrors: true})
+	assert.Error(t, err)
+	agg, ok := err.(*AggregateError)
+	if assert.True(t, ok) {
+		assert.Len(t, agg.Errors, 4)
+	}
+
+	err = ParseWithOptions(cfg, Options{})
+	assert.Error(t, err)
+	_, ok = err.(*AggregateError)
+	assert.False(t, ok)
+}
+
+func TestParseErrors(t *testing.T) {
+	type config struct {
+		Home  string        `env:"HOME,required"`
+		Port  int           `env:"PORT"`
+		Ports []int         `env:"PORTS"`
+		Delay time.Duration `env:"DELAY"`
+	}
+
+	os.Setenv("PORT", "should-be-an-int")
+	os.Setenv("PORTS", "1,x")
+	os.Setenv("DELAY", "1s")
+	defer os.Clearenv()
+
+	err := ParseWithOptions(&config{}, Options{CollectAllErrors: true})
+	var agg *AggregateError
+	if !assert.True(t, errors.As(err, &agg)) {
+		return
+	}
+	assert.Len(t, agg.Errors, 3)
+
+	perrs := agg.ParseErrors()
+	assert.Len(t, perrs, 2)
+	assert.Equal(t, []string{"Port", "Ports"}, perrs.Fields())
+	assert.Equal(t, "2 environment variables could not be parsed:\n\t"+
+		`Unable to parse PORT="should-be-an-int" into field Port: strconv.ParseInt: parsing "should-be-an-int": invalid syntax`+"\n\t"+
+		`Unable to parse PORTS="1,x" into field Ports: strconv.ParseInt: parsing "x": invalid syntax`, perrs.Error())
+
+	for _, e := range []error{err, perrs} {
+		assert.True(t, errors.Is(e, &ParseError{Field: "Port"}))
+		assert.True(t, errors.Is(e, &ParseError{Key: "PORTS"}))
+		assert.False(t, errors.Is(e, &ParseError{Field: "Delay"}))
+		assert.True(t, errors.Is(e, strconv.ErrSyntax))
+	}
+
+	var perr *ParseError
+	if assert.True(t, errors.As(perrs, &perr)) {
+		assert.Equal(t, "Port", perr.Field)
+	}
+
+	// the Is and As methods work without Unwrap() []error, before Go 1.20
+	assert.True(t, perrs.Is(&ParseError{Field: "Ports"}))
+	assert.False(t, perrs.Is(&ParseError{Field: "Delay"}))
+	assert.True(t, agg.Is(strconv.ErrSyntax))
+	perr = nil
+	if assert.True(t, agg.As(&perr)) {
+		assert.Equal(t, "Port", perr.Field)
+	}
+	for _, p := range perrs {
+		assert.Error(t, p.Err)
+	}
+
+	os.Setenv("PORT", "1")
+	os.Setenv("PORTS", "1")
+	err = ParseWithOptions(&config{}, Options{CollectAllErrors: true})
+	if assert.True(t, errors.As(err, &agg)) {
+		assert.Nil(t, agg.ParseErrors())
+	}
+}
+
+func TestParseWithOptionsPrefixAndParsers(t *testing.T) {
+	type foobar struct {
+		name string
+	}
+	type config struct {
+		Home  string `env:"HOME"`
+		Bar   foobar `env:"BAR"`
+		Inner *InnerStruct
+	}
+
+	os.Setenv("APP_HOME", "/home/me")
+	os.Setenv("APP_BAR", "bar")
+	os.Setenv("APP_innervar", "inner")
+	defer os.Clearenv()
+
+	cfg := &config{Inner: &InnerStruct{}}
+	assert.NoError(t, ParseWithOptions(cfg, Options{
+		Prefix: "APP_",
+		CustomParsers: CustomParsers{
+			reflect.TypeOf(foobar{}): func(v string) (interface{}, error) {
+				return foobar{name: v}, nil
+			},
+		},
+	}))
+	assert.Equal(t, "/home/me", cfg.Home)
+	assert.Equal(t, "bar", cfg.Bar.name)
+	assert.Equal(t, "inner", cfg.Inner.Inner)
+}
+
+func TestParseWithOptionsFieldParsers(t *testing.T) {
+	type config struct {
+		Hosts  string   `env:"HOSTS"`
+		Meta   string   `env:"META"`
+		Plain  string   `env:"PLAIN"`
+		Failed []string `env:"FAILED"`
+	}
+
+	os.Setenv("HOSTS", "a,b")
+	os.Setenv("META", `{"name":"env"}`)
+	os.Setenv("PLAIN", "plain")
+	defer os.Clearenv()
+
+	upper := func(v string) (interface{}, error) {
+		return strings.ToUpper(v), nil
+	}
+	opts := Options{
+		CustomParsers: CustomParsers{
+			reflect.TypeOf(""): upper,
+		},
+		FieldParsers: map[string]ParserFunc{
+			"Hosts": func(v string) (interface{}, error) {
+				return strings.Join(strings.Split(v, ","), " "), nil
+			},
+			"Meta": func(v string) (interface{}, error) {
+				var m map[string]string
+				err := json.Unmarshal([]byte(v), &m)
+				return m["name"], err
+			},
+			"Failed": func(v string) (interface{}, error) {
+				return nil, errors.New("nope")
+			},
+		},
+	}
+
+	cfg := &config{}
+	assert.NoError(t, ParseWithOptions(cfg, opts))
+	assert.Equal(t, "a b", cfg.Hosts)
+	assert.Equal(t, "env", cfg.Meta)
+	assert.Equal(t, "PLAIN", cfg.Plain)
+
+	os.Setenv("FAILED", "x")
+	err := ParseWithOptions(cfg, opts)
+	assert.EqualError(t, err, `Unable to parse FAILED="x" into field Failed: Custom parser error: nope`)
+}
+
+func TestParseWithOptionsStructFieldParsers(t *testing.T) {
+	type config struct {
+		Started  time.Time  `env:"STARTED" envFormat:"unix"`
+		Finished *time.Time `env:"FINISHED" envFormat:"date"`
+		Plain    string     `env:"PLAIN"`
+	}
+
+	os.Setenv("STARTED", "1523318400")
+	os.Setenv("FINISHED", "2018-04-10")
+	os.Setenv("PLAIN", "plain")
+	defer os.Clearenv()
+
+	opts := Options{
+		StructFieldParsers: StructFieldParsers{
+			reflect.TypeOf(time.Time{}): func(v string, field reflect.StructField) (interface{}, error) {
+				if field.Tag.Get("envFormat") == "unix" {
+					sec, err := strconv.ParseInt(v, 10, 64)
+					return time.Unix(sec, 0).UTC(), err
+				}
+				return time.Parse("2006-01-02", v)
+			},
+		},
+		CustomParsers: CustomParsers{
+			reflect.TypeOf(time.Time{}): func(v string) (interface{}, error) {
+				return nil, errors.New("should not be called")
+			},
+		},
+	}
+
+	cfg := &config{}
+	assert.NoError(t, ParseWithOptions(cfg, opts))
+	assert.Equal(t, time.Date(2018, 4, 10, 0, 0, 0, 0, time.UTC), cfg.Started)
+	assert.Equal(t, time.Date(2018, 4, 10, 0, 0, 0, 0, time.UTC), *cfg.Finished)
+	assert.Equal(t, "plain", cfg.Plain)
+}
+
+func TestParseWithOptionsTagName(t *testing.T) {
+	type server struct {
+		Host string `config:"HOST"`
+	}
+	type config struct {
+		Home    string   `config:"HOME,required"`
+		Port    int      `config:"PORT" configDefault:"3000"`
+		Hosts   []string `config:"HOSTS" configSeparator:":"`
+		Legacy  string   `env:"LEGACY"`
+		DB      server   `configPrefix:"DB_"`
+		Servers []server `configPrefix:"SERVER"`
+	}
+
+	os.Setenv("HOME", "/home/me")
+	os.Setenv("HOSTS", "a:b")
+	os.Setenv("LEGACY", "legacy")
+	os.Setenv("DB_HOST", "db")
+	os.Setenv("SERVER_0_HOST", "server")
+	defer os.Clearenv()
+
+	cfg := &config{}
+	assert.NoError(t, ParseWithOptions(cfg, Options{TagName: "config"}))
+	assert.Equal(t, &config{
+		Home:    "/home/me",
+		Port:    3000,
+		Hosts:   []string{"a", "b"},
+		DB:      server{Host: "db"},
+		Servers: []server{{Host: "server"}},
+	}, cfg)
+
+	cfg = &config{}
+	assert.NoError(t, Parse(cfg))
+	assert.Equal(t, &config{Legacy: "legacy"}, cfg)
+
+	os.Unsetenv("HOME")
+	err := ParseWithOptions(&config{}, Options{TagName: "config"})
+	assert.EqualError(t, err, "Required environment variable HOME is not set")
+}
+
+func TestParseWithOptionsTagNameCallbacks(t *testing.T) {
+	type point struct{ X, Y int }
+	type config struct {
+		StartsAt time.Time `config:"STARTS_AT" layout:"2006-01-02"`
+		Origin   point     `config:"ORIGIN" json:"origin"`
+	}
+
+	os.Setenv("STARTS_AT", "2018-04-05")
+	os.Setenv("ORIGIN", "1")
+	defer os.Clearenv()
+
+	var tags []string
+	cfg := &config{}
+	assert.NoError(t, ParseWithOptions(cfg, Options{
+		TagName: "config",
+		StructFieldParsers: StructFieldParsers{
+			reflect.TypeOf(time.Time{}): func(v string, field reflect.StructField) (interface{}, error) {
+				return time.Parse(field.Tag.Get("layout"), v)
+			},
+		},
+		FallbackParser: func(field reflect.StructField, value string) (reflect.Value, bool, error) {
+			tags = append(tags, field.Tag.Get("json"), field.Tag.Get("config"))
+			return reflect.ValueOf(point{X: 1}), true, nil
+		},
+	}))
+	assert.Equal(t, time.Date(2018, 4, 5, 0, 0, 0, 0, time.UTC), cfg.StartsAt)
+	assert.Equal(t, point{X: 1}, cfg.Origin)
+	assert.Equal(t, []string{"origin", "ORIGIN"}, tags)
+}
+
+func TestParseWithOptionsExportDefaults(t *testing.T) {
+	type config struct {
+		Home  string `env:"HOME" envDefault:"/home/default"`
+		Port  int    `env:"PORT" envDefault:"3000"`
+		Other string `env:"OTHER"`
+	}
+
+	os.Setenv("APP_PORT", "8080")
+	defer os.Clearenv()
+
+	cfg := &config{}
+	assert.NoError(t, ParseWithOptions(cfg, Options{Prefix: "APP_", ExportDefaults: true}))
+	assert.Equal(t, "/home/default", os.Getenv("APP_HOME"))
+	assert.Equal(t, "8080", os.Getenv("APP_PORT"))
+	_, ok := os.LookupEnv("APP_OTHER")
+	assert.False(t, ok)
+
+	exported := map[string]string{}
+	assert.NoError(t, ParseWithOptions(cfg, Options{
+		Source:         MapSource(map[string]string{"PORT": "8080"}),
+		ExportDefaults: true,
+		Setenv: func(key, value string) error {
+			exported[key] = value
+			return nil
+		},
+	}))
+	assert.Equal(t, map[string]string{"HOME": "/home/default"}, exported)
+
+	err := ParseWithOptions(cfg, Options{
+		ExportDefaults: true,
+		Setenv: func(key, value string) error {
+			return errors.New("read-only")
+		},
+	})
+	assert.EqualError(t, err, "Unable to export default of HOME: read-only. Unable to export default of PORT: read-only")
+}
+
+func TestParseWithOptionsConsumed(t *testing.T) {
+	type server struct {
+		Host string `env:"HOST"`
+	}
+	type config struct {
+		Home    string   `env:"HOME"`
+		Port    int      `env:"PORT" envDefault:"3000"`
+		Name    string   `env:"NEW_NAME" envAliases:"OLD_NAME"`
+		Servers []server `envPrefix:"SERVER"`
+		Ignored string
+	}
+
+	os.Setenv("APP_HOME", "/home/me")
+	os.Setenv("APP_OLD_NAME", "name")
+	os.Setenv("APP_SERVER_0_HOST", "a")
+	defer os.Clearenv()
+
+	var consumed []ConsumedKey
+	assert.NoError(t, ParseWithOptions(&config{}, Options{Prefix: "APP_", Consumed: &consumed}))
+	assert.Equal(t, []ConsumedKey{
+		{Key: "APP_HOME", Found: true},
+		{Key: "APP_PORT", Found: false},
+		{Key: "APP_OLD_NAME", Found: true},
+		{Key: "APP_SERVER_0_HOST", Found: true},
+	}, consumed)
+}
+
+func TestParseWithOptionsStrict(t *testing.T) {
+	type server struct {
+		Host string `env:"HOST"`
+	}
+	type config struct {
+		Port    int      `env:"PORT"`
+		Name    string   `env:"NEW_NAME" envAliases:"OLD_NAME"`
+		Secret  string   `env:"SECRET" envFile:"true"`
+		Servers []server `envPrefix:"SERVER"`
+	}
+
+	os.Setenv("MYAPP_PORT", "8080")
+	os.Setenv("MYAPP_NEW_NAME", "new")
+	os.Setenv("MYAPP_OLD_NAME", "old")
+	os.Setenv("MYAPP_SECRET_FILE", "/dev/null")
+	os.Setenv("MYAPP_SERVER_0_HOST", "a")
+	os.Setenv("OTHER_PROT", "ignored")
+	defer os.Clearenv()
+
+	assert.NoError(t, ParseWithOptions(&config{}, Options{Prefix: "MYAPP_", Strict: true}))
+
+	os.Setenv("MYAPP_PROT", "8080")
+	os.Setenv("MYAPP_SERVER_1_HSOT", "b")
+	err := ParseWithOptions(&config{}, Options{Prefix: "MYAPP_", Strict: true})
+	assert.EqualError(t, err, "Unknown environment variables with prefix MYAPP_: MYAPP_PROT, MYAPP_SERVER_1_HSOT")
+	assert.NoError(t, ParseWithOptions(&config{}, Options{Prefix: "MYAPP_"}))
+
+	err = ParseWithOptions(&config{}, Options{
+		Prefix: "MYAPP_",
+		Strict: true,
+		Source: MapSource(map[string]string{"MYAPP_PORT": "1"}),
+	})
+	assert.EqualError(t, err, "Strict mode needs SourceKeys to list the variables of Source")
+
+	source := map[string]string{"MYAPP_PORT": "1", "MYAPP_TYPO": "x"}
+	err = ParseWithOptions(&config{}, Options{
+		Prefix:     "MYAPP_",
+		Strict:     true,
+		Source:     MapSource(source),
+		SourceKeys: MapSourceKeys(source),
+	})
+	assert.EqualError(t, err, "Unknown environment variables with prefix MYAPP_: MYAPP_TYPO")
+
+	// the variables of a nil nested struct pointer are known too
+	type inner struct {
+		X string `env:"X"`
+	}
+	type nested struct {
+		In *inner `envPrefix:"IN_"`
+	}
+	os.Clearenv()
+	os.Setenv("APP_IN_X", "x")
+	assert.NoError(t, ParseWithOptions(&nested{}, Options{Prefix: "APP_", Strict: true}))
+	os.Setenv("APP_IN_Y", "y")
+	err = ParseWithOptions(&nested{}, Options{Prefix: "APP_", Strict: true})
+	assert.EqualError(t, err, "Unknown environment variables with prefix APP_: APP_IN_Y")
+}
+
+func TestParseWithOptionsMessages(t *testing.T) {
+	type config struct {
+		Home  string `env:"HOME,required"`
+		Token string `env:"TOKEN,notEmpty"`
+		Mode  string `env:"MODE,oneof=dev|prod"`
+	}
+	opts := Options{
+		CollectAllErrors: true,
+		RequiredMessage: func(key string) string {
+			return `{"missing":"` + key + `"}`
+		},
+		EmptyMessage: func(key string) string {
+			return `{"empty":"` + key + `"}`
+		},
+		OneOfMessage: func(key, value string, allowed []string) string {
+			return `{"invalid":"` + key + `","allowed":"` + strings.Join(allowed, "|") + `"}`
+		},
+	}
+
+	os.Setenv("TOKEN", "")
+	os.Setenv("MODE", "test")
+	defer os.Clearenv()
+
+	err := ParseWithOptions(&config{}, opts)
+	assert.EqualError(t, err, `{"missing":"HOME"}. {"empty":"TOKEN"}. {"invalid":"MODE","allowed":"dev|prod"}`)
+
+	err = ParseWithOptions(&config{}, Options{CollectAllErrors: true})
+	assert.EqualError(t, err, `Required environment variable HOME is not set. Environment variable TOKEN is set but empty. Environment variable MODE must be one of dev, prod, got "test"`)
+
+	os.Unsetenv("TOKEN")
+	err = ParseWithOptions(&config{}, opts)
+	assert.EqualError(t, err, `{"missing":"HOME"}. {"missing":"TOKEN"}. {"invalid":"MODE","allowed":"dev|prod"}`)
+}
+
+type storageBackend interface {
+	Name() string
+}
+
+type s3Backend struct {
+	Bucket string `env:"BUCKET,required"`
+}
+
+func (s *s3Backend) Name() string { return "s3:" + s.Bucket }
+
+type localBackend string
+
+func (l localBackend) Name() string { return "local" }
+
+func TestParseWithOptionsConstructors(t *testing.T) {
+	type config struct {
+		Backend storageBackend `env:"STORAGE" envPrefix:"S3_"`
+	}
+	opts := Options{
+		Constructors: map[reflect.Type]map[string]Constructor{
+			reflect.TypeOf((*storageBackend)(nil)).Elem(): {
+				"s3": func() (interface{}, error) {
+					return &s3Backend{}, nil
+				},
+				"local": func() (interface{}, error) {
+					return localBackend("/tmp"), nil
+				},
+				"gcs": func() (interface{}, error) {
+					return nil, errors.New("not implemented")
+				},
+				"broken": func() (interface{}, error) {
+					return "not a backend", nil
+				},
+			},
+		},
+	}
+	defer os.Clearenv()
+
+	os.Setenv("STORAGE", "s3")
+	os.Setenv("S3_BUCKET", "my-bucket")
+	cfg := &config{}
+	assert.NoError(t, ParseWithOptions(cfg, opts))
+	assert.Equal(t, "s3:my-bucket", cfg.Backend.Name())
+
+	os.Setenv("STORAGE", "local")
+	cfg = &config{}
+	assert.NoError(t, ParseWithOptions(cfg, opts))
+	assert.Equal(t, localBackend("/tmp"), cfg.Backend)
+
+	os.Setenv("STORAGE", "s3")
+	os.Unsetenv("S3_BUCKET")
+	err := ParseWithOptions(&config{}, opts)
+	assert.EqualError(t, err, "Required environment variable S3_BUCKET is not set")
+
+	os.Setenv("STORAGE", "azure")
+	err = ParseWithOptions(&config{}, opts)
+	assert.EqualError(t, err, `Unable to parse STORAGE="azure" into field Backend: Unknown implementation "azure", expected one of: broken, gcs, local, s3`)
+
+	os.Setenv("STORAGE", "gcs")
+	err = ParseWithOptions(&config{}, opts)
+	assert.EqualError(t, err, `Unable to parse STORAGE="gcs" into field Backend: Constructor error: not implemented`)
+
+	os.Setenv("STORAGE", "broken")
+	err = ParseWithOptions(&config{}, opts)
+	assert.EqualError(t, err, `Unable to parse STORAGE="broken" into field Backend: Constructor "broken" returned string, which does not implement env.storageBackend`)
+}
+
+func TestParseUnset(t *testing.T) {
+	type config struct {
+		Secret   string `env:"SECRET,required,unset"`
+		Token    string `env:"TOKEN,unset" envAliases:"OLD_TOKEN"`
+		Empty    string `env:"EMPTY,unset"`
+		Port     int    `env:"PORT,unset"`
+		Home     string `env:"HOME"`
+		Missing  string `env:"MISSING,unset"`
+		Required string `env:"REQUIRED,required,unset"`
+	}
+
+	os.Setenv("SECRET", "s3cr3t")
+	os.Setenv("OLD_TOKEN", "token")
+	os.Setenv("EMPTY", "")
+	os.Setenv("PORT", "not-a-port")
+	os.Setenv("HOME", "/home/me")
+	defer os.Clearenv()
+
+	cfg := &config{}
+	err := ParseWithOptions(cfg, Options{CollectAllErrors: true})
+	assert.Error(t, err)
+	assert.Equal(t, "s3cr3t", cfg.Secret)
+	assert.Equal(t, "token", cfg.Token)
+	for _, key := range []string{"SECRET", "OLD_TOKEN", "EMPTY"} {
+		_, ok := os.LookupEnv(key)
+		assert.False(t, ok, key)
+	}
+	assert.Equal(t, "not-a-port", os.Getenv("PORT"))
+	assert.Equal(t, "/home/me", os.Getenv("HOME"))
+
+	source := map[string]string{"SECRET": "s3cr3t", "REQUIRED": "x"}
+	os.Setenv("SECRET", "from-env")
+	cfg = &config{}
+	assert.NoError(t, ParseWithSource(cfg, MapSource(source)))
+	assert.Equal(t, "s3cr3t", cfg.Secret)
+	assert.Equal(t, "from-env", os.Getenv("SECRET"))
+
+	// the variable read case-insensitively is the one removed
+	os.Clearenv()
+	os.Setenv("secret", "v")
+	os.Setenv("required", "x")
+	cfg = &config{}
+	assert.NoError(t, ParseWithOptions(cfg, Options{CaseInsensitive: true}))
+	assert.Equal(t, "v", cfg.Secret)
+	for _, key := range []string{"secret", "required"} {
+		_, ok := os.LookupEnv(key)
+		assert.False(t, ok, key)
+	}
+}
+
+func TestParseWithOptionsBoolValues(t *testing.T) {
+	type config struct {
+		Debug   bool   `env:"DEBUG"`
+		Verbose *bool  `env:"VERBOSE"`
+		Plain   bool   `env:"PLAIN"`
+		Flags   []bool `env:"FLAGS"`
+	}
+
+	os.Setenv("DEBUG", "Yes")
+	os.Setenv("VERBOSE", "OFF")
+	os.Setenv("PLAIN", "true")
+	os.Setenv("FLAGS", "on,no,1")
+	defer os.Clearenv()
+
+	opts := Options{BoolValues: map[string]bool{"yes": true, "on": true, "no": false, "off": false}}
+	cfg := &config{}
+	assert.NoError(t, ParseWithOptions(cfg, opts))
+	assert.True(t, cfg.Debug)
+	assert.False(t, *cfg.Verbose)
+	assert.True(t, cfg.Plain)
+	assert.Equal(t, []bool{true, false, true}, cfg.Flags)
+
+	os.Setenv("DEBUG", "maybe")
+	assert.Error(t, ParseWithOptions(&config{}, opts))
+
+	os.Setenv("DEBUG", "yes")
+	assert.Error(t, Parse(&config{}))
+}
+
+func TestParseNoPrefix(t *testing.T) {
+	type server struct {
+		Host string `env:"HOST"`
+		Home string `env:"HOME,noprefix"`
+	}
+	type config struct {
+		Name    string   `env:"NAME"`
+		Home    string   `env:"HOME,required,noprefix"`
+		DB      server   `envPrefix:"DB_"`
+		Servers []server `envPrefix:"SERVER"`
+	}
+
+	os.Setenv("APP_NAME", "app")
+	os.Setenv("HOME", "/home/me")
+	os.Setenv("APP_HOME", "/home/app")
+	os.Setenv("APP_DB_HOST", "db")
+	os.Setenv("APP_SERVER_0_HOST", "a")
+	defer os.Clearenv()
+
+	cfg := &config{}
+	assert.NoError(t, PrefixedParse(cfg, "APP_"))
+	assert.Equal(t, "app", cfg.Name)
+	assert.Equal(t, "/home/me", cfg.Home)
+	assert.Equal(t, "db", cfg.DB.Host)
+	assert.Equal(t, "/home/me", cfg.DB.Home)
+	assert.Equal(t, []server{{Host: "a", Home: "/home/me"}}, cfg.Servers)
+
+	cfg = &config{}
+	assert.NoError(t, Parse(cfg))
+	assert.Equal(t, "/home/me", cfg.Home)
+
+	ret, err := Marshal(&config{Home: "/root", DB: server{Home: "/db"}})
+	assert.NoError(t, err)
+	assert.Equal(t, "/db", ret["HOME"])
+	assert.NotContains(t, ret, "DB_HOME")
+}
+
+func TestParseWithOptionsDefaultProviders(t *testing.T) {
+	type config struct {
+		Host    string `env:"HOST"`
+		TempDir string `env:"TEMP_DIR"`
+		Static  string `env:"STATIC" envDefault:"static"`
+		Set     string `env:"SET"`
+		Broken  string `env:"BROKEN"`
+	}
+
+	os.Setenv("APP_SET", "set")
+	defer os.Clearenv()
+
+	calls := 0
+	provide := func(value string) func() (string, error) {
+		return func() (string, error) {
+			calls++
+			return value, nil
+		}
+	}
+	var defaults []string
+	opts := Options{
+		Prefix: "APP_",
+		DefaultProviders: map[string]func() (string, error){
+			"APP_HOST": provide("by-key"),
+			"Host":     provide("by-field"),
+			"TempDir":  provide("/tmp"),
+			"Static":   provide("provided"),
+			"SET":      provide("provided"),
+		},
+		OnDefault: func(field, key, value string) {
+			defaults = append(defaults, field+"="+value)
+		},
+	}
+	cfg := &config{}
+	assert.NoError(t, ParseWithOptions(cfg, opts))
+	assert.Equal(t, "by-key", cfg.Host)
+	assert.Equal(t, "/tmp", cfg.TempDir)
+	assert.Equal(t, "static", cfg.Static)
+	assert.Equal(t, "set", cfg.Set)
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, []string{"Host=by-key", "TempDir=/tmp", "Static=static"}, defaults)
+
+	opts.DefaultProviders["Broken"] = func() (string, error) {
+		return "", errors.New("no hostname")
+	}
+	err := ParseWithOptions(&config{}, opts)
+	var perr *ParseError
+	if assert.True(t, errors.As(err, &perr)) {
+		assert.Equal(t, "Broken", perr.Field)
+		assert.Equal(t, "APP_BROKEN", perr.Key)
+		assert.EqualError(t, perr.Err, "no hostname")
+	}
+}
+
+type severity uint8
+
+func (s severity) String() string {
+	return [...]string{"low", "high"}[s]
+}
+
+func TestParseWithOptionsEnums(t *testing.T) {
+	type config struct {
+		Level    logLevel   `env:"LEVEL"`
+		Levels   []logLevel `env:"LEVELS"`
+		Severity *severity  `env:"SEVERITY"`
+		Port     int        `env:"PORT"`
+	}
+
+	os.Setenv("LEVEL", "warn")
+	os.Setenv("LEVELS", "debug,warn")
+	os.Setenv("SEVERITY", "high")
+	os.Setenv("PORT", "8080")
+	defer os.Clearenv()
+
+	opts := Options{Enums: map[reflect.Type]map[string]int64{
+		reflect.TypeOf(logLevel(0)): {"debug": 0, "info": 1, "warn": 2},
+		reflect.TypeOf(severity(0)): {"low": 0, "high": 1},
+	}}
+	cfg := &config{}
+	assert.NoError(t, ParseWithOptions(cfg, opts))
+	assert.Equal(t, logLevel(2), cfg.Level)
+	assert.Equal(t, []logLevel{0, 2}, cfg.Levels)
+	assert.Equal(t, "high", cfg.Severity.String())
+	assert.Equal(t, 8080, cfg.Port)
+
+	os.Setenv("LEVEL", "verbose")
+	err := ParseWithOptions(&config{}, opts)
+	var perr *ParseError
+	if assert.True(t, errors.As(err, &perr)) {
+		assert.Equal(t, "Level", perr.Field)
+		assert.Contains(t, perr.Err.Error(), `"verbose", expected one of debug, info, warn`)
+	}
+	assert.Error(t, ValidateWithOptions(&config{}, opts))
+
+	opts.CustomParsers = CustomParsers{
+		reflect.TypeOf(logLevel(0)): func(v string) (interface{}, error) {
+			return logLevel(42), nil
+		},
+	}
+	cfg = &config{}
+	assert.NoError(t, ParseWithOptions(cfg, opts))
+	assert.Equal(t, logLevel(42), cfg.Level)
+}
+
+func TestParseWithPrefixes(t *testing.T) {
+	type database struct {
+		Host string `env:"HOST"`
+	}
+	type config struct {
+		Home    string   `env:"HOME"`
+		Port    int      `env:"PORT" envDefault:"3000"`
+		Token   string   `env:"TOKEN" envAliases:"OLD_TOKEN"`
+		User    string   `env:"USER"`
+		Shell   string   `env:"SHELL,noprefix"`
+		DB      database `envPrefix:"DB_"`
+		Missing string   `env:"MISSING,required"`
+	}
+
+	os.Setenv("MYAPP_HOME", "/myapp")
+	os.Setenv("HOME", "/home/me")
+	os.Setenv("PORT", "8080")
+	os.Setenv("OLD_TOKEN", "old")
+	os.Setenv("OTHER_USER", "other")
+	os.Setenv("USER", "me")
+	os.Setenv("SHELL", "/bin/sh")
+	os.Setenv("DB_HOST", "db")
+	os.Setenv("MISSING", "found")
+	defer os.Clearenv()
+
+	cfg := &config{}
+	assert.NoError(t, ParseWithPrefixes(cfg, "MYAPP_", "OTHER_", ""))
+	assert.Equal(t, config{
+		Home:    "/myapp",
+		Port:    8080,
+		Token:   "old",
+		User:    "other",
+		Shell:   "/bin/sh",
+		DB:      database{Host: "db"},
+		Missing: "found",
+	}, *cfg)
+
+	os.Unsetenv("PORT")
+	os.Unsetenv("MISSING")
+	cfg = &config{}
+	err := ParseWithPrefixes(cfg, "MYAPP_", "")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "MYAPP_MISSING")
+	assert.Equal(t, 3000, cfg.Port)
+
+	os.Setenv("MYAPP_UNKNOWN", "x")
+	os.Setenv("MISSING", "found")
+	err = ParseWithOptions(&config{}, Options{Prefixes: []string{"MYAPP_", ""}, Strict: true})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "MYAPP_UNKNOWN")
+}
+
+func TestParseWithOptionsSkipNonEmpty(t *testing.T) {
+	type config struct {
+		Host    string        `env:"HOST,required"`
+		Port    int           `env:"PORT" envDefault:"3000"`
+		Debug   bool          `env:"DEBUG" envDefault:"true"`
+		Timeout time.Duration `env:"TIMEOUT" envDefault:"5s"`
+		Tags    []string      `env:"TAGS" envAliases:"LABELS"`
+		Level   string        `env:"LEVEL" envDefault:"info"`
+	}
+
+	os.Setenv("TIMEOUT", "10s")
+	os.Setenv("LABELS", "a,b")
+	defer os.Clearenv()
+
+	cfg := &config{Host: "runtime", Port: 8080, Timeout: time.Second, Tags: []string{"x"}}
+	assert.NoError(t, ParseWithOptions(cfg, Options{SkipNonEmpty: true}))
+	assert.Equal(t, &config{
+		Host:    "runtime",
+		Port:    8080,
+		Debug:   true,
+		Timeout: 10 * time.Second,
+		Tags:    []string{"a", "b"},
+		Level:   "info",
+	}, cfg)
+
+	err := ParseWithOptions(&config{}, Options{SkipNonEmpty: true})
+	assert.EqualError(t, err, "Required environment variable HOST is not set")
+
+	os.Setenv("HOST", "env")
+	cfg = &config{Host: "runtime", Port: 8080}
+	assert.NoError(t, ParseWithOptions(cfg, Options{SkipNonEmpty: true}))
+	assert.Equal(t, "env", cfg.Host)
+	assert.Equal(t, 8080, cfg.Port)
+
+	assert.NoError(t, ParseWithOptions(cfg, Options{}))
+	assert.Equal(t, 3000, cfg.Port)
+}
+
+func TestParseWithOptionsFallbackParser(t *testing.T) {
+	type point struct {
+		X, Y int
+	}
+	type config struct {
+		Origin  point    `env:"ORIGIN"`
+		Target  *point   `env:"TARGET"`
+		Corners []point  `env:"CORNERS"`
+		Other   struct{} `env:"OTHER"`
+		Port    int      `env:"PORT"`
+	}
+
+	var seen []string
+	fallback := func(field reflect.StructField, value string) (reflect.Value, bool, error) {
+		seen = append(seen, field.Name)
+		switch field.Type {
+		case reflect.TypeOf(point{}), reflect.TypeOf(&point{}):
+			var p point
+			if _, err := fmt.Sscanf(value, "%d,%d", &p.X, &p.Y); err != nil {
+				return reflect.Value{}, true, err
+			}
+			return reflect.ValueOf(p), true, nil
+		case reflect.TypeOf([]point{}):
+			return reflect.ValueOf([]point{{X: len(value)}}), true, nil
+		}
+		return reflect.Value{}, false, nil
+	}
+
+	os.Setenv("ORIGIN", "1,2")
+	os.Setenv("TARGET", "3,4")
+	os.Setenv("CORNERS", "abc")
+	os.Setenv("PORT", "8080")
+	defer os.Clearenv()
+
+	cfg := &config{}
+	assert.NoError(t, ParseWithOptions(cfg, Options{FallbackParser: fallback}))
+	assert.Equal(t, point{X: 1, Y: 2}, cfg.Origin)
+	assert.Equal(t, &point{X: 3, Y: 4}, cfg.Target)
+	assert.Equal(t, []point{{X: 3}}, cfg.Corners)
+	assert.Equal(t, 8080, cfg.Port)
+	assert.Equal(t, []string{"Origin", "Target", "Corners"}, seen)
+
+	os.Setenv("OTHER", "x")
+	err := ParseWithOptions(&config{}, Options{FallbackParser: fallback})
+	assert.True(t, errors.Is(err, ErrUnsupportedType))
+	assert.True(t, errors.Is(err, &ParseError{Field: "Other"}))
+
+	os.Unsetenv("OTHER")
+	os.Setenv("ORIGIN", "nope")
+	err = ParseWithOptions(&config{}, Options{FallbackParser: fallback})
+	var perr *ParseError
+	if assert.True(t, errors.As(err, &perr)) {
+		assert.Equal(t, "Origin", perr.Field)
+		assert.Equal(t, "ORIGIN", perr.Key)
+	}
+
+	os.Setenv("ORIGIN", "1,2")
+	err = ParseWithOptions(&config{}, Options{
+		FallbackParser: func(field reflect.StructField, value string) (reflect.Value, bool, error) {
+			return reflect.ValueOf(value), true, nil
+		},
+	})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "FallbackParser returned a string, which is not assignable to env.point")
+}
+
+func TestParseWithOptionsProfile(t *testing.T) {
+	type config struct {
+		Host  string `env:"HOST" envDefaultProfiles:"dev=localhost;prod=db.internal"`
+		Port  int    `env:"PORT" envDefaultProfiles:"dev=5433" envDefault:"5432"`
+		Level string `env:"LEVEL" envDefault:"debug"`
+		Token string `env:"TOKEN" envDefaultProfiles:"dev=t0k3n"`
+		DSN   string `env:"DSN" envDefault:"host=localhost sslmode=disable"`
+	}
+
+	defer os.Clearenv()
+
+	cfg := &config{}
+	assert.NoError(t, ParseWithOptions(cfg, Options{Profile: "prod"}))
+	assert.Equal(t, &config{Host: "db.internal", Port: 5432, Level: "debug", DSN: "host=localhost sslmode=disable"}, cfg)
+
+	cfg = &config{}
+	assert.NoError(t, ParseWithOptions(cfg, Options{Profile: "dev"}))
+	assert.Equal(t, &config{Host: "localhost", Port: 5433, Level: "debug", Token: "t0k3n", DSN: "host=localhost sslmode=disable"}, cfg)
+
+	os.Setenv("HOST", "override")
+	cfg = &config{}
+	assert.NoError(t, ParseWithOptions(cfg, Options{Profile: "prod"}))
+	assert.Equal(t, "override", cfg.Host)
+
+	err := ParseWithOptions(&config{}, Options{Profile: "staging", RequiredIfNoDef: true})
+	assert.EqualError(t, err, "Required environment variable TOKEN is not set")
+
+	noProfile := &config{}
+	assert.NoError(t, ParseWithOptions(noProfile, Options{}))
+	assert.Equal(t, &config{Host: "override", Port: 5432, Level: "debug", DSN: "host=localhost sslmode=disable"}, noProfile)
+
+	for spec, msg := range map[string]string{
+		"dev=a;b":     `entry "b" is not profile=value`,
+		"=a;dev=b":    `entry "=a" has an invalid profile name`,
+		"dev env=a":   `entry "dev env=a" has an invalid profile name`,
+		"dev=a;dev=b": `profile "dev" is listed twice`,
+	} {
+		_, _, err := profileDefault(spec, "dev")
+		assert.EqualError(t, err, msg, spec)
+	}
+
+	type bad struct {
+		Host string `env:"HOST" envDefaultProfiles:"dev=a;dev=b"`
+	}
+	err = ParseWithOptions(&bad{}, Options{})
+	assert.EqualError(t, err, `Invalid envDefaultProfiles of field Host: profile "dev" is listed twice`)
+}
+
+func TestParseWithOptionsZeroValue(t *testing.T) {
+	os.Setenv("somevar", "somevalue")
+	os.Setenv("intvar", "8080")
+	os.Setenv("durations", "1s,2s")
+	defer os.Clearenv()
+
+	expected := Config{}
+	assert.NoError(t, Parse(&expected))
+	actual := Config{}
+	assert.NoError(t, ParseWithOptions(&actual, Options{}))
+	assert.Equal(t, expected, actual)
 
+	assert.Equal(t, ErrNotAStructPtr, ParseWithOptions(Config{}, Options{}))
 }
 
 func ExampleParse() {
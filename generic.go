@@ -0,0 +1,20 @@
+//go:build go1.18
+// +build go1.18
+
+package env
+
+// ParseAs allocates a T, parses it with `Parse` and returns it, saving the
+// boilerplate of declaring a variable and taking its address.
+func ParseAs[T any]() (T, error) {
+	var v T
+	err := Parse(&v)
+	return v, err
+}
+
+// ParseAsWithPrefix is the same as `ParseAs` except it adds prefix to
+// environment variable names, like `PrefixedParse`.
+func ParseAsWithPrefix[T any](prefix string) (T, error) {
+	var v T
+	err := PrefixedParse(&v, prefix)
+	return v, err
+}
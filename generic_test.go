@@ -0,0 +1,33 @@
+//go:build go1.18
+// +build go1.18
+
+package env
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAs(t *testing.T) {
+	type config struct {
+		Home string `env:"HOME"`
+		Port int    `env:"PORT" envDefault:"3000"`
+	}
+
+	os.Setenv("HOME", "/tmp/fakehome")
+	os.Setenv("PREFIX_HOME", "/tmp/prefixed")
+	defer os.Clearenv()
+
+	cfg, err := ParseAs[config]()
+	assert.NoError(t, err)
+	assert.Equal(t, config{Home: "/tmp/fakehome", Port: 3000}, cfg)
+
+	cfg, err = ParseAsWithPrefix[config]("PREFIX_")
+	assert.NoError(t, err)
+	assert.Equal(t, config{Home: "/tmp/prefixed", Port: 3000}, cfg)
+
+	_, err = ParseAs[int]()
+	assert.Equal(t, ErrNotAStructPtr, err)
+}
@@ -0,0 +1,89 @@
+package env
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"time"
+)
+
+// GetString returns the value of the environment variable key, or def if it
+// is not set or empty.
+func GetString(key, def string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return def
+}
+
+// GetInt returns the value of the environment variable key converted like an
+// int field by `Parse`, or def if it is not set, empty or invalid.
+func GetInt(key string, def int) int {
+	v, _ := getAs(key, def)
+	return v.(int)
+}
+
+// GetBool is the same as `GetInt` for a bool.
+func GetBool(key string, def bool) bool {
+	v, _ := getAs(key, def)
+	return v.(bool)
+}
+
+// GetFloat64 is the same as `GetInt` for a float64.
+func GetFloat64(key string, def float64) float64 {
+	v, _ := getAs(key, def)
+	return v.(float64)
+}
+
+// GetDuration is the same as `GetInt` for a time.Duration.
+func GetDuration(key string, def time.Duration) time.Duration {
+	v, _ := getAs(key, def)
+	return v.(time.Duration)
+}
+
+// MustGetInt is the same as `GetInt` except it panics if the value is
+// invalid.
+func MustGetInt(key string, def int) int {
+	return mustGetAs(key, def).(int)
+}
+
+// MustGetBool is the same as `GetBool` except it panics if the value is
+// invalid.
+func MustGetBool(key string, def bool) bool {
+	return mustGetAs(key, def).(bool)
+}
+
+// MustGetFloat64 is the same as `GetFloat64` except it panics if the value is
+// invalid.
+func MustGetFloat64(key string, def float64) float64 {
+	return mustGetAs(key, def).(float64)
+}
+
+// MustGetDuration is the same as `GetDuration` except it panics if the value
+// is invalid.
+func MustGetDuration(key string, def time.Duration) time.Duration {
+	return mustGetAs(key, def).(time.Duration)
+}
+
+// getAs converts the value of the environment variable key into the type of
+// def with `ParseValue`. It returns def if the variable is not set or empty,
+// along with the conversion error if any.
+func getAs(key string, def interface{}) (interface{}, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return def, nil
+	}
+	v, err := ParseValue(reflect.TypeOf(def), value, "")
+	if err != nil {
+		return def, fmt.Errorf("Unable to parse %s=%q: %v", key, value, err)
+	}
+	return v, nil
+}
+
+func mustGetAs(key string, def interface{}) interface{} {
+	v, err := getAs(key, def)
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
@@ -0,0 +1,50 @@
+package env
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetters(t *testing.T) {
+	os.Setenv("NAME", "env")
+	os.Setenv("PORT", "8080")
+	os.Setenv("DEBUG", "true")
+	os.Setenv("RATIO", "0.5")
+	os.Setenv("TIMEOUT", "1m")
+	os.Setenv("EMPTY", "")
+	defer os.Clearenv()
+
+	assert.Equal(t, "env", GetString("NAME", "def"))
+	assert.Equal(t, "def", GetString("EMPTY", "def"))
+	assert.Equal(t, 8080, GetInt("PORT", 80))
+	assert.Equal(t, 80, GetInt("UNSET", 80))
+	assert.Equal(t, 80, GetInt("NAME", 80))
+	assert.Equal(t, true, GetBool("DEBUG", false))
+	assert.Equal(t, false, GetBool("NAME", false))
+	assert.Equal(t, 0.5, GetFloat64("RATIO", 1))
+	assert.Equal(t, 1.0, GetFloat64("EMPTY", 1))
+	assert.Equal(t, time.Minute, GetDuration("TIMEOUT", time.Second))
+	assert.Equal(t, time.Second, GetDuration("PORT", time.Second))
+}
+
+func TestMustGetters(t *testing.T) {
+	os.Setenv("PORT", "8080")
+	os.Setenv("NAME", "env")
+	defer os.Clearenv()
+
+	assert.Equal(t, 8080, MustGetInt("PORT", 80))
+	assert.Equal(t, 80, MustGetInt("UNSET", 80))
+	assert.Equal(t, true, MustGetBool("UNSET", true))
+	assert.Equal(t, 2.5, MustGetFloat64("UNSET", 2.5))
+	assert.Equal(t, time.Second, MustGetDuration("UNSET", time.Second))
+
+	assert.PanicsWithError(t, `Unable to parse NAME="env": strconv.ParseInt: parsing "env": invalid syntax`, func() {
+		MustGetInt("NAME", 80)
+	})
+	assert.Panics(t, func() { MustGetBool("NAME", false) })
+	assert.Panics(t, func() { MustGetFloat64("NAME", 0) })
+	assert.Panics(t, func() { MustGetDuration("NAME", 0) })
+}
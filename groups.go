@@ -0,0 +1,67 @@
+package env
+
+import (
+	"fmt"
+	"strings"
+)
+
+// GroupRule tells how many variables of a `KeyGroup` may be set.
+type GroupRule int
+
+const (
+	// ExactlyOne requires one and only one variable of the group to be set
+	ExactlyOne GroupRule = iota
+	// AtLeastOne requires one or more variables of the group to be set
+	AtLeastOne
+	// AtMostOne allows zero or one variable of the group to be set
+	AtMostOne
+)
+
+// KeyGroup constrains how many of a list of environment variables are set,
+// e.g. to require either `API_KEY` or `OAUTH_TOKEN` but not both. A variable
+// set to an empty string counts as not set.
+type KeyGroup struct {
+	// Keys are the names of the variables, without the prefix of the
+	// `Options`
+	Keys []string
+	// Rule is the constraint on the number of variables set
+	Rule GroupRule
+}
+
+func (g KeyGroup) check(prefix string, lookup func(string) (string, bool)) error {
+	keys := make([]string, 0, len(g.Keys))
+	var set []string
+	for _, key := range g.Keys {
+		keys = append(keys, prefix+key)
+		if value, ok := lookup(prefix + key); ok && value != "" {
+			set = append(set, prefix+key)
+		}
+	}
+
+	var rule string
+	switch g.Rule {
+	case ExactlyOne:
+		if len(set) == 1 {
+			return nil
+		}
+		rule = "Exactly one"
+	case AtLeastOne:
+		if len(set) >= 1 {
+			return nil
+		}
+		rule = "At least one"
+	case AtMostOne:
+		if len(set) <= 1 {
+			return nil
+		}
+		rule = "At most one"
+	default:
+		return fmt.Errorf("Unknown rule %d for group %s", g.Rule, strings.Join(keys, ", "))
+	}
+
+	got := "none"
+	if len(set) > 0 {
+		got = strings.Join(set, ", ")
+	}
+	return fmt.Errorf("%s of environment variables %s must be set (set: %s)", rule, strings.Join(keys, ", "), got)
+}
@@ -0,0 +1,86 @@
+package env
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseWithOptionsGroups(t *testing.T) {
+	type config struct {
+		APIKey     string `env:"API_KEY"`
+		OAuthToken string `env:"OAUTH_TOKEN"`
+	}
+	auth := KeyGroup{Keys: []string{"API_KEY", "OAUTH_TOKEN"}, Rule: ExactlyOne}
+	defer os.Clearenv()
+
+	err := ParseWithOptions(&config{}, Options{Groups: []KeyGroup{auth}})
+	assert.EqualError(t, err, "Exactly one of environment variables API_KEY, OAUTH_TOKEN must be set (set: none)")
+
+	os.Setenv("API_KEY", "key")
+	cfg := &config{}
+	assert.NoError(t, ParseWithOptions(cfg, Options{Groups: []KeyGroup{auth}}))
+	assert.Equal(t, "key", cfg.APIKey)
+
+	os.Setenv("OAUTH_TOKEN", "token")
+	err = ParseWithOptions(&config{}, Options{Groups: []KeyGroup{auth}})
+	assert.EqualError(t, err, "Exactly one of environment variables API_KEY, OAUTH_TOKEN must be set (set: API_KEY, OAUTH_TOKEN)")
+
+	os.Setenv("OAUTH_TOKEN", "")
+	assert.NoError(t, ParseWithOptions(&config{}, Options{Groups: []KeyGroup{auth}}))
+}
+
+func TestParseWithOptionsGroupRules(t *testing.T) {
+	type config struct {
+		A string `env:"A"`
+	}
+	source := MapSource(map[string]string{"APP_A": "a", "APP_B": "b"})
+	defer os.Clearenv()
+
+	for _, tt := range []struct {
+		group KeyGroup
+		err   string
+	}{
+		{KeyGroup{Keys: []string{"A", "C"}, Rule: AtLeastOne}, ""},
+		{KeyGroup{Keys: []string{"C", "D"}, Rule: AtLeastOne}, "At least one of environment variables APP_C, APP_D must be set (set: none)"},
+		{KeyGroup{Keys: []string{"C", "D"}, Rule: AtMostOne}, ""},
+		{KeyGroup{Keys: []string{"A", "B"}, Rule: AtMostOne}, "At most one of environment variables APP_A, APP_B must be set (set: APP_A, APP_B)"},
+		{KeyGroup{Keys: []string{"A"}, Rule: GroupRule(42)}, "Unknown rule 42 for group APP_A"},
+	} {
+		err := ParseWithOptions(&config{}, Options{Prefix: "APP_", Source: source, Groups: []KeyGroup{tt.group}})
+		if tt.err == "" {
+			assert.NoError(t, err)
+		} else {
+			assert.EqualError(t, err, tt.err)
+		}
+	}
+}
+
+func TestParseWithOptionsGroupsCollectAllErrors(t *testing.T) {
+	type config struct {
+		Port int `env:"PORT"`
+	}
+	os.Setenv("PORT", "nope")
+	defer os.Clearenv()
+
+	opts := Options{Groups: []KeyGroup{{Keys: []string{"API_KEY", "OAUTH_TOKEN"}}}}
+	err := ParseWithOptions(&config{}, opts)
+	var perr *ParseError
+	assert.True(t, errors.As(err, &perr), "groups are not checked after a failure")
+
+	opts.CollectAllErrors = true
+	err = ParseWithOptions(&config{}, opts)
+	var agg *AggregateError
+	if assert.True(t, errors.As(err, &agg)) {
+		assert.Len(t, agg.Errors, 2)
+	}
+
+	err = Validate(&config{})
+	assert.True(t, errors.As(err, &agg))
+	assert.Len(t, agg.Errors, 1)
+	err = ValidateWithOptions(&config{}, opts)
+	assert.True(t, errors.As(err, &agg))
+	assert.Len(t, agg.Errors, 2)
+}
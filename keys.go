@@ -0,0 +1,85 @@
+package env
+
+import "reflect"
+
+// VarInfo describes an environment variable read by `Parse`.
+type VarInfo struct {
+	// Key is the name of the environment variable
+	Key string
+	// Field is the name of the struct field
+	Field string
+	// Type is the name of the type of the struct field
+	Type string
+	// Required tells if the variable must be set
+	Required bool
+	// Default is the value of the `envDefault` tag
+	Default string
+}
+
+// Keys lists the environment variables read by `Parse` for v, a struct or a
+// pointer to a struct. It looks nothing up, so it can be used to generate
+// documentation. Nested structs are flattened, and the variables of slices of
+// structs are listed with a `<n>` placeholder for the index, and those of maps
+// of structs with a `<name>` placeholder. Keys reads the `env` tags, whatever
+// the `Options.TagName` used to parse v.
+func Keys(v interface{}) ([]VarInfo, error) {
+	refType := reflect.TypeOf(v)
+	if refType != nil && refType.Kind() == reflect.Ptr {
+		refType = refType.Elem()
+	}
+	if refType == nil || refType.Kind() != reflect.Struct {
+		return nil, ErrNotAStructPtr
+	}
+
+	var ret []VarInfo
+	walkVars(refType, "", "", map[reflect.Type]bool{}, func(fp fieldPlan, key string) {
+		info := VarInfo{
+			Key:     key,
+			Field:   fp.field.Name,
+			Type:    fp.field.Type.String(),
+			Default: fp.field.Tag.Get("envDefault"),
+		}
+		for _, opt := range fp.opts {
+			if opt == "required" || opt == "notEmpty" {
+				info.Required = true
+			}
+		}
+		ret = append(ret, info)
+	})
+	return ret, nil
+}
+
+// walkVars calls fn with the plan and the key, prefixes included, of every
+// variable read for the struct type t, in the order `Parse` reads them.
+// walking holds the struct types being walked: a type met again inside
+// itself, like the element of `Next *node` in node, is skipped, since `Parse`
+// only follows pointers which are not nil.
+func walkVars(t reflect.Type, prefix, tagName string, walking map[reflect.Type]bool, fn func(fp fieldPlan, key string)) {
+	if walking[t] {
+		return
+	}
+	walking[t] = true
+	defer delete(walking, t)
+
+	for _, fp := range planFor(t, tagName) {
+		nestedPrefix := prefix + fp.field.Tag.Get("envPrefix")
+		switch fp.kind {
+		case fieldPtr:
+			if fp.field.Type.Elem().Kind() == reflect.Struct {
+				walkVars(fp.field.Type.Elem(), nestedPrefix, tagName, walking, fn)
+			}
+		case fieldNested:
+			walkVars(fp.field.Type, nestedPrefix, tagName, walking, fn)
+		case fieldStructSlice:
+			walkVars(fp.field.Type.Elem(), nestedPrefix+"_<n>_", tagName, walking, fn)
+		case fieldStructMap:
+			walkVars(fp.field.Type.Elem(), nestedPrefix+"_<name>_", tagName, walking, fn)
+		case fieldValue:
+			if fp.noPrefix {
+				fn(fp, fp.key)
+			} else {
+				fn(fp, prefix+fp.key)
+			}
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package env
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeys(t *testing.T) {
+	type server struct {
+		Host string `env:"HOST,required"`
+	}
+	type database struct {
+		Host string `env:"HOST,required"`
+		User string `env:"USER,noprefix"`
+	}
+	type config struct {
+		Home     string        `env:"HOME"`
+		Port     int           `env:"PORT" envDefault:"3000"`
+		Token    string        `env:"TOKEN,notEmpty"`
+		Timeout  time.Duration `env:"TIMEOUT"`
+		NotAnEnv string
+		Inner    *InnerStruct
+		Servers  []server          `envPrefix:"SERVER"`
+		DB       database          `envPrefix:"DB_"`
+		Backends map[string]server `envPrefix:"BACKEND"`
+	}
+
+	infos, err := Keys(&config{})
+	assert.NoError(t, err)
+	assert.Equal(t, []VarInfo{
+		{Key: "HOME", Field: "Home", Type: "string"},
+		{Key: "PORT", Field: "Port", Type: "int", Default: "3000"},
+		{Key: "TOKEN", Field: "Token", Type: "string", Required: true},
+		{Key: "TIMEOUT", Field: "Timeout", Type: "time.Duration"},
+		{Key: "innervar", Field: "Inner", Type: "string"},
+		{Key: "innernum", Field: "Number", Type: "uint"},
+		{Key: "SERVER_<n>_HOST", Field: "Host", Type: "string", Required: true},
+		{Key: "DB_HOST", Field: "Host", Type: "string", Required: true},
+		{Key: "USER", Field: "User", Type: "string"},
+		{Key: "BACKEND_<name>_HOST", Field: "Host", Type: "string", Required: true},
+	}, infos)
+
+	_, err = Keys(42)
+	assert.Equal(t, ErrNotAStructPtr, err)
+}
+
+func TestKeysSelfReferential(t *testing.T) {
+	type node struct {
+		Name     string `env:"NAME"`
+		Next     *node  `envPrefix:"NEXT_"`
+		Children []node `envPrefix:"CHILD"`
+	}
+
+	infos, err := Keys(&node{})
+	assert.NoError(t, err)
+	assert.Equal(t, []VarInfo{
+		{Key: "NAME", Field: "Name", Type: "string"},
+	}, infos)
+}
@@ -0,0 +1,336 @@
+package env
+
+import (
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Marshal is the inverse of `Parse`: it walks the `env` tags of v, a struct or
+// a pointer to a struct, and returns the string representation of each field
+// keyed by its environment variable name. Fields without an `env` tag are
+// skipped.
+func Marshal(v interface{}) (map[string]string, error) {
+	ret, _, err := marshal(v)
+	return ret, err
+}
+
+// marshal returns the variables of v like `Marshal`, and the set of those
+// read by fields tagged with `envSecret:"true"`.
+func marshal(v interface{}) (map[string]string, map[string]bool, error) {
+	ref := reflect.Indirect(reflect.ValueOf(v))
+	if ref.Kind() != reflect.Struct {
+		return nil, nil, ErrNotAStructPtr
+	}
+
+	ret := make(map[string]string)
+	secrets := make(map[string]bool)
+	if err := doMarshal(ref, "", ret, secrets); err != nil {
+		return nil, nil, err
+	}
+	return ret, secrets, nil
+}
+
+func doMarshal(ref reflect.Value, prefix string, ret map[string]string, secrets map[string]bool) error {
+	refType := ref.Type()
+
+	for i := 0; i < refType.NumField(); i++ {
+		field, fieldType := ref.Field(i), refType.Field(i)
+		// unexported fields, embedded ones included, can't be read
+		if fieldType.Tag.Get("env") == "-" || fieldType.PkgPath != "" {
+			continue
+		}
+		if reflect.Ptr == field.Kind() && !field.IsNil() && fieldType.Tag.Get("env") == "" {
+			if field.Elem().Kind() != reflect.Struct {
+				continue
+			}
+			if err := doMarshal(field.Elem(), prefix+fieldType.Tag.Get("envPrefix"), ret, secrets); err != nil {
+				return err
+			}
+			continue
+		}
+		if isNestedStruct(fieldType) {
+			if err := doMarshal(field, prefix+fieldType.Tag.Get("envPrefix"), ret, secrets); err != nil {
+				return err
+			}
+			continue
+		}
+		if isStructMap(fieldType) {
+			names := make([]string, 0, field.Len())
+			for _, k := range field.MapKeys() {
+				names = append(names, k.String())
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				elemPrefix := prefix + fieldType.Tag.Get("envPrefix") + "_" + strings.ToUpper(name) + "_"
+				elem := field.MapIndex(reflect.ValueOf(name).Convert(field.Type().Key()))
+				if err := doMarshal(elem, elemPrefix, ret, secrets); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if isStructSlice(fieldType) {
+			for idx := 0; idx < field.Len(); idx++ {
+				elemPrefix := prefix + fieldType.Tag.Get("envPrefix") + "_" + strconv.Itoa(idx) + "_"
+				if err := doMarshal(field.Index(idx), elemPrefix, ret, secrets); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		key, opts := parseKeyForOption(fieldType.Tag.Get("env"))
+		if key == "" {
+			continue
+		}
+		// a presence variable is true whenever it is set, whatever its value
+		if fieldType.Tag.Get("envPresence") == "true" && !isPresent(field) {
+			continue
+		}
+		value, err := format(field, fieldType)
+		if err != nil {
+			return err
+		}
+		fieldPrefix := prefix
+		for _, opt := range opts {
+			if opt == "noprefix" {
+				fieldPrefix = ""
+			}
+		}
+		ret[fieldPrefix+key] = value
+		if isSecret(fieldType) {
+			secrets[fieldPrefix+key] = true
+		}
+	}
+	return nil
+}
+
+// isPresent tells whether the bool, or pointer to a bool, of an envPresence
+// field is true.
+func isPresent(field reflect.Value) bool {
+	if field.Kind() == reflect.Ptr {
+		return !field.IsNil() && field.Elem().Bool()
+	}
+	return field.Bool()
+}
+
+func format(field reflect.Value, refType reflect.StructField) (string, error) {
+	if refType.Tag.Get("envJSON") == "true" {
+		data, err := json.Marshal(field.Interface())
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	}
+
+	switch field.Type() {
+	case ipType:
+		if field.IsNil() {
+			return "", nil
+		}
+		return field.Interface().(net.IP).String(), nil
+	case ipNetType:
+		if field.IsNil() {
+			return "", nil
+		}
+		return field.Interface().(*net.IPNet).String(), nil
+	case macType:
+		return field.Interface().(net.HardwareAddr).String(), nil
+	case regexpPtrType:
+		if field.IsNil() {
+			return "", nil
+		}
+		return field.Interface().(*regexp.Regexp).String(), nil
+	case urlPtrType:
+		if field.IsNil() {
+			return "", nil
+		}
+		return field.Interface().(*url.URL).String(), nil
+	case urlType:
+		u := field.Interface().(url.URL)
+		return u.String(), nil
+	case locationPtrType:
+		if field.IsNil() {
+			return "", nil
+		}
+		return field.Interface().(*time.Location).String(), nil
+	case fileModeType:
+		return fmt.Sprintf("%04o", field.Uint()), nil
+	case urlValuesType:
+		return field.Interface().(url.Values).Encode(), nil
+	case bigIntType:
+		n := field.Interface().(big.Int)
+		return n.String(), nil
+	case bigFloatType:
+		f := field.Interface().(big.Float)
+		return f.Text('g', -1), nil
+	case timeType:
+		t := field.Interface().(time.Time)
+		switch layout := refType.Tag.Get("envLayout"); layout {
+		case "":
+			return t.Format(time.RFC3339), nil
+		case "unix":
+			return strconv.FormatInt(t.Unix(), 10), nil
+		case "unixmilli":
+			return strconv.FormatInt(t.Unix()*1000+int64(t.Nanosecond())/int64(time.Millisecond), 10), nil
+		default:
+			return t.Format(layout), nil
+		}
+	}
+
+	if isSQLNull(field.Type()) {
+		if !field.Field(1).Bool() {
+			return "", nil
+		}
+		return format(field.Field(0), refType)
+	}
+
+	switch field.Kind() {
+	case reflect.Ptr:
+		if field.IsNil() {
+			return "", nil
+		}
+		return format(field.Elem(), refType)
+	case reflect.Slice:
+		if field.Type().Elem().Kind() == reflect.Uint8 {
+			return formatBytes(field.Bytes(), refType)
+		}
+		separator := refType.Tag.Get("envSeparator")
+		if separator == "" {
+			separator = ","
+		}
+		data := make([]string, 0, field.Len())
+		for i := 0; i < field.Len(); i++ {
+			v, err := format(field.Index(i), refType)
+			if err != nil {
+				return "", err
+			}
+			data = append(data, v)
+		}
+		if refType.Tag.Get("envCSV") == "true" {
+			return formatCSV(data, separator)
+		}
+		return strings.Join(data, separator), nil
+	case reflect.Array:
+		data := reflect.MakeSlice(reflect.SliceOf(field.Type().Elem()), field.Len(), field.Len())
+		reflect.Copy(data, field)
+		return format(data, refType)
+	case reflect.Map:
+		if isQuery(refType) {
+			return url.Values(field.Interface().(map[string][]string)).Encode(), nil
+		}
+		return formatMap(field, refType)
+	case reflect.String:
+		return field.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(field.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32:
+		if field.Kind() == reflect.Int32 && refType.Tag.Get("envRune") == "true" {
+			return string(rune(field.Int())), nil
+		}
+		return strconv.FormatInt(field.Int(), formatBase(refType)), nil
+	case reflect.Int64:
+		if field.Type() == durationType {
+			return time.Duration(field.Int()).String(), nil
+		}
+		return strconv.FormatInt(field.Int(), formatBase(refType)), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(field.Uint(), formatBase(refType)), nil
+	case reflect.Float32:
+		return strconv.FormatFloat(field.Float(), 'g', -1, 32), nil
+	case reflect.Float64:
+		return strconv.FormatFloat(field.Float(), 'g', -1, 64), nil
+	case reflect.Complex64, reflect.Complex128:
+		return strconv.FormatComplex(field.Complex(), 'g', -1, field.Type().Bits()), nil
+	}
+	return "", ErrUnsupportedType
+}
+
+// formatBase returns the base to write the integers of the field in, which
+// is its envBase, or 10 if it is detected from the value.
+func formatBase(refType reflect.StructField) int {
+	base, err := intBase(refType)
+	if err != nil || base == 0 {
+		return 10
+	}
+	return base
+}
+
+func formatCSV(data []string, separator string) (string, error) {
+	var b strings.Builder
+	w := csv.NewWriter(&b)
+	w.Comma, _ = utf8.DecodeRuneInString(separator)
+	if err := w.Write(data); err != nil {
+		return "", err
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(b.String(), "\n"), nil
+}
+
+func formatBytes(data []byte, refType reflect.StructField) (string, error) {
+	switch refType.Tag.Get("envEncoding") {
+	case "":
+		return string(data), nil
+	case "base64":
+		return base64.StdEncoding.EncodeToString(data), nil
+	case "hex":
+		return hex.EncodeToString(data), nil
+	}
+	return "", ErrUnsupportedType
+}
+
+func formatMap(field reflect.Value, refType reflect.StructField) (string, error) {
+	if field.Type() != mapOfStrings && field.Type() != mapOfInts && field.Type() != mapOfStringSlices {
+		return "", ErrUnsupportedType
+	}
+
+	separator := refType.Tag.Get("envSeparator")
+	if separator == "" {
+		separator = ","
+	}
+	kvSeparator := refType.Tag.Get("envKeyValSeparator")
+	if kvSeparator == "" {
+		kvSeparator = ":"
+	}
+
+	keys := make([]string, 0, field.Len())
+	for _, k := range field.MapKeys() {
+		keys = append(keys, k.String())
+	}
+	sort.Strings(keys)
+
+	data := make([]string, 0, len(keys))
+	for _, k := range keys {
+		if field.Type() == mapOfStringSlices {
+			for _, v := range field.MapIndex(reflect.ValueOf(k)).Interface().([]string) {
+				data = append(data, k+kvSeparator+v)
+			}
+			continue
+		}
+		v, err := format(field.MapIndex(reflect.ValueOf(k)), refType)
+		if err != nil {
+			return "", err
+		}
+		data = append(data, k+kvSeparator+v)
+	}
+	if refType.Tag.Get("envCSV") == "true" {
+		return formatCSV(data, separator)
+	}
+	return strings.Join(data, separator), nil
+}
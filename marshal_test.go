@@ -0,0 +1,210 @@
+package env
+
+import (
+	"database/sql"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMarshal(t *testing.T) {
+	type server struct {
+		Host string `env:"HOST"`
+	}
+	type config struct {
+		Home      string          `env:"HOME"`
+		Port      int             `env:"PORT"`
+		Debug     bool            `env:"DEBUG"`
+		Ratio     float64         `env:"RATIO"`
+		Timeout   time.Duration   `env:"TIMEOUT"`
+		Hosts     []string        `env:"HOSTS" envSeparator:":"`
+		Numbers   []int           `env:"NUMBERS"`
+		Durations []time.Duration `env:"DURATIONS"`
+		Flags     map[string]int  `env:"FLAGS"`
+		StartsAt  time.Time       `env:"STARTS_AT" envLayout:"2006-01-02"`
+		Bind      net.IP          `env:"BIND"`
+		Endpoint  *url.URL        `env:"ENDPOINT"`
+		Servers   []server        `envPrefix:"SERVER"`
+		Inner     *InnerStruct
+		NotAnEnv  string
+		PortPtr   *int                `env:"PORT_PTR"`
+		Key       []byte              `env:"KEY" envEncoding:"hex"`
+		Unset     *int                `env:"UNSET"`
+		Labels    map[string]string   `env:"LABELS" envKeyValSeparator:"="`
+		Triple    [3]int              `env:"TRIPLE"`
+		Windows   []time.Time         `env:"WINDOWS" envLayout:"15:04"`
+		Supply    *big.Int            `env:"SUPPLY"`
+		Rates     []*big.Float        `env:"RATES"`
+		Delimiter rune                `env:"DELIM" envRune:"true"`
+		Names     []string            `env:"NAMES" envCSV:"true"`
+		DSN       sql.NullString      `env:"DSN"`
+		MaxConns  sql.NullInt64       `env:"MAX_CONNS"`
+		MACs      []net.HardwareAddr  `env:"MACS"`
+		Filter    *regexp.Regexp      `env:"FILTER"`
+		Headers   map[string][]string `env:"HEADERS" envSeparator:"|"`
+		Backends  []server            `env:"BACKENDS" envJSON:"true"`
+		Named     map[string]server   `envPrefix:"NAMED"`
+		Expires   time.Time           `env:"EXPIRES" envLayout:"unixmilli"`
+		Params    url.Values          `env:"PARAMS"`
+		Mask      uint32              `env:"MASK" envBase:"16"`
+		Perm      int                 `env:"PERM" envBase:"0"`
+		Umask     os.FileMode         `env:"UMASK"`
+		TZ        *time.Location      `env:"TZ"`
+		Notes     map[string]string   `env:"NOTES" envCSV:"true" envKeyValSeparator:"="`
+	}
+
+	endpoint, _ := url.Parse("https://example.com/api")
+	cfg := config{
+		Home:      "/home/me",
+		Port:      8080,
+		Debug:     true,
+		Ratio:     0.5,
+		Timeout:   1500 * time.Millisecond,
+		Hosts:     []string{"a", "b"},
+		Numbers:   []int{1, 2, 3},
+		Durations: []time.Duration{time.Second, time.Minute},
+		Flags:     map[string]int{"b": 2, "a": 1},
+		StartsAt:  time.Date(2018, 4, 5, 0, 0, 0, 0, time.UTC),
+		Bind:      net.ParseIP("127.0.0.1"),
+		Endpoint:  endpoint,
+		Servers:   []server{{Host: "x"}, {Host: "y"}},
+		Inner:     &InnerStruct{Inner: "in", Number: 3},
+		NotAnEnv:  "skipped",
+		Labels:    map[string]string{"app": "web"},
+		Triple:    [3]int{1, 2, 3},
+		Windows:   []time.Time{time.Date(0, 1, 1, 8, 0, 0, 0, time.UTC)},
+		Supply:    new(big.Int).Lsh(big.NewInt(1), 70),
+		Rates:     []*big.Float{big.NewFloat(0.25)},
+		Delimiter: '→',
+		Names:     []string{"a,b", "c"},
+		DSN:       sql.NullString{String: "postgres://", Valid: true},
+		MaxConns:  sql.NullInt64{Int64: 10},
+		MACs:      []net.HardwareAddr{{0, 0x1b, 0x63, 0x84, 0x45, 0xe6}, {0xde, 0xad, 0xbe, 0xef, 0, 1}},
+		Filter:    regexp.MustCompile(`^a+$`),
+		Headers:   map[string][]string{"b": {"3"}, "a": {"1", "2"}},
+		Backends:  []server{{Host: "z"}},
+		Named:     map[string]server{"eu_west": {Host: "w"}},
+		Expires:   time.Unix(1700000000, 250*int64(time.Millisecond)),
+		Params:    url.Values{"b": {"x y"}, "a": {"1", "3"}},
+		Mask:      0xff00,
+		Perm:      0o755,
+		Umask:     0o22,
+		TZ:        time.UTC,
+		Notes:     map[string]string{"hosts": "a,b", "tier": "front"},
+	}
+	cfg.Key = []byte{0xde, 0xad}
+	port := 9090
+	cfg.PortPtr = &port
+
+	ret, err := Marshal(&cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"HOME":               "/home/me",
+		"PORT":               "8080",
+		"DEBUG":              "true",
+		"RATIO":              "0.5",
+		"TIMEOUT":            "1.5s",
+		"HOSTS":              "a:b",
+		"NUMBERS":            "1,2,3",
+		"DURATIONS":          "1s,1m0s",
+		"FLAGS":              "a:1,b:2",
+		"STARTS_AT":          "2018-04-05",
+		"BIND":               "127.0.0.1",
+		"ENDPOINT":           "https://example.com/api",
+		"SERVER_0_HOST":      "x",
+		"SERVER_1_HOST":      "y",
+		"innervar":           "in",
+		"innernum":           "3",
+		"LABELS":             "app=web",
+		"PORT_PTR":           "9090",
+		"UNSET":              "",
+		"KEY":                "dead",
+		"TRIPLE":             "1,2,3",
+		"WINDOWS":            "08:00",
+		"SUPPLY":             "1180591620717411303424",
+		"RATES":              "0.25",
+		"DELIM":              "→",
+		"NAMES":              `"a,b",c`,
+		"DSN":                "postgres://",
+		"MAX_CONNS":          "",
+		"MACS":               "00:1b:63:84:45:e6,de:ad:be:ef:00:01",
+		"FILTER":             "^a+$",
+		"HEADERS":            "a:1|a:2|b:3",
+		"BACKENDS":           `[{"Host":"z"}]`,
+		"NAMED_EU_WEST_HOST": "w",
+		"EXPIRES":            "1700000000250",
+		"PARAMS":             "a=1&a=3&b=x+y",
+		"MASK":               "ff00",
+		"PERM":               "493",
+		"UMASK":              "0022",
+		"TZ":                 "UTC",
+		"NOTES":              `"hosts=a,b",tier=front`,
+	}, ret)
+}
+
+func TestMarshalRoundTrip(t *testing.T) {
+	cfg := Config{
+		Some:      "somevalue",
+		Port:      8080,
+		Float32s:  []float32{1.5, 2},
+		Durations: []time.Duration{time.Second},
+	}
+
+	ret, err := Marshal(cfg)
+	assert.NoError(t, err)
+	defer os.Clearenv()
+	for k, v := range ret {
+		os.Setenv(k, v)
+	}
+
+	parsed := Config{}
+	assert.NoError(t, Parse(&parsed))
+	assert.Equal(t, cfg, parsed)
+}
+
+func TestMarshalPresence(t *testing.T) {
+	type config struct {
+		Debug   bool  `env:"DEBUG" envPresence:"true"`
+		Verbose bool  `env:"VERBOSE" envPresence:"true"`
+		Trace   *bool `env:"TRACE" envPresence:"true"`
+	}
+
+	cfg := config{Verbose: true}
+	ret, err := Marshal(&cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"VERBOSE": "true"}, ret)
+
+	defer os.Clearenv()
+	for k, v := range ret {
+		os.Setenv(k, v)
+	}
+	parsed := config{}
+	assert.NoError(t, Parse(&parsed))
+	assert.False(t, parsed.Debug)
+	assert.True(t, parsed.Verbose)
+	if assert.NotNil(t, parsed.Trace) {
+		assert.False(t, *parsed.Trace)
+	}
+
+	changes, err := Diff(&config{Debug: true}, &config{})
+	assert.NoError(t, err)
+	assert.Equal(t, []FieldChange{{Key: "DEBUG", Old: "true"}}, changes)
+}
+
+func TestMarshalErrors(t *testing.T) {
+	type unsupported struct {
+		Ch chan int `env:"CH"`
+	}
+
+	_, err := Marshal(&unsupported{})
+	assert.Equal(t, ErrUnsupportedType, err)
+
+	_, err = Marshal("not a struct")
+	assert.Equal(t, ErrNotAStructPtr, err)
+}
@@ -0,0 +1,177 @@
+package env
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// fieldKind tells how the parser handles a struct field.
+type fieldKind int
+
+const (
+	// fieldSkip fields are ignored by the parser, either because they have no
+	// env tag or because it is "-"
+	fieldSkip fieldKind = iota
+	// fieldValue fields are set from an environment variable
+	fieldValue
+	// fieldPtr fields are untagged pointers, parsed recursively when not nil
+	fieldPtr
+	// fieldNested fields are nested structs, parsed recursively
+	fieldNested
+	// fieldStructSlice fields are slices of structs read from indexed variables
+	fieldStructSlice
+	// fieldStructMap fields are maps of structs read from named variables
+	fieldStructMap
+)
+
+// fieldPlan holds what the parser needs to know about a struct field, which
+// only depends on its type and tags.
+type fieldPlan struct {
+	index int
+	// field has its tags renamed after "env", see renameTags, for the lookups
+	// of the parser
+	field reflect.StructField
+	// orig is the field as declared, with all its tags, for the callbacks of
+	// the user
+	orig reflect.StructField
+	kind fieldKind
+	// key is the name of the variable, without prefix
+	key string
+	// opts are the options following the key in the env tag
+	opts []string
+	// unset tells whether the variable is removed from the environment once
+	// read
+	unset bool
+	// noPrefix tells whether the key is read as is, without the prefixes of
+	// the parent structs
+	noPrefix bool
+	// tagErr is the error reported by checkBoundsTags, checkSeparatorTags or
+	// checkPresenceTag, if any
+	tagErr error
+}
+
+// planKey identifies a plan: the same type read with another tag name has
+// another plan.
+type planKey struct {
+	t       reflect.Type
+	tagName string
+}
+
+// plans caches the plan of each struct type, as a []fieldPlan keyed by
+// planKey.
+var plans sync.Map
+
+// planFor returns the plan of the struct type t, computing it on first use.
+// tagName replaces "env" as the base name of the tags, see `Options.TagName`.
+func planFor(t reflect.Type, tagName string) []fieldPlan {
+	if tagName == "" {
+		tagName = "env"
+	}
+	key := planKey{t: t, tagName: tagName}
+	if plan, ok := plans.Load(key); ok {
+		return plan.([]fieldPlan)
+	}
+
+	plan := make([]fieldPlan, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		orig := field
+		if tagName != "env" {
+			field.Tag = renameTags(field.Tag, tagName)
+		}
+		fp := fieldPlan{index: i, field: field, orig: orig}
+		if field.Tag.Get("env") == "-" {
+			plan = append(plan, fp)
+			continue
+		}
+		fp.key, fp.opts = parseKeyForOption(field.Tag.Get("env"))
+		for _, opt := range fp.opts {
+			fp.unset = fp.unset || opt == "unset"
+			fp.noPrefix = fp.noPrefix || opt == "noprefix"
+		}
+
+		switch {
+		case field.Type.Kind() == reflect.Ptr && field.Tag.Get("env") == "":
+			fp.kind = fieldPtr
+		case isNestedStruct(field):
+			fp.kind = fieldNested
+		case isStructSlice(field):
+			fp.kind = fieldStructSlice
+		case isStructMap(field):
+			fp.kind = fieldStructMap
+		case field.Tag.Get("env") == "":
+			fp.kind = fieldSkip
+		default:
+			fp.kind = fieldValue
+			fp.tagErr = checkBoundsTags(field)
+			if fp.tagErr == nil {
+				fp.tagErr = checkSeparatorTags(field)
+			}
+			if fp.tagErr == nil {
+				fp.tagErr = checkPresenceTag(field)
+			}
+		}
+		plan = append(plan, fp)
+	}
+
+	actual, _ := plans.LoadOrStore(key, plan)
+	return actual.([]fieldPlan)
+}
+
+// renameTags rewrites tag so that the tags named after tagName read as the
+// ones named after "env", e.g. `config:"HOST" configDefault:"localhost"` becomes
+// `env:"HOST" envDefault:"localhost"`. Other tags are dropped, the callbacks
+// of the user get them from fieldPlan.orig.
+func renameTags(tag reflect.StructTag, tagName string) reflect.StructTag {
+	var ret []string
+	for _, pair := range tagPairs(string(tag)) {
+		name, value := pair[0], pair[1]
+		if !strings.HasPrefix(name, tagName) {
+			continue
+		}
+		suffix := strings.TrimPrefix(name, tagName)
+		if suffix != "" && (suffix[0] < 'A' || suffix[0] > 'Z') {
+			continue
+		}
+		ret = append(ret, "env"+suffix+":"+strconv.Quote(value))
+	}
+	return reflect.StructTag(strings.Join(ret, " "))
+}
+
+// tagPairs splits a struct tag into its name and value pairs, following the
+// conventional format parsed by reflect.StructTag.Get.
+func tagPairs(tag string) [][2]string {
+	var ret [][2]string
+	for tag != "" {
+		tag = strings.TrimLeft(tag, " ")
+		i := 0
+		for i < len(tag) && tag[i] > ' ' && tag[i] != ':' && tag[i] != '"' && tag[i] != 0x7f {
+			i++
+		}
+		if i == 0 || i+1 >= len(tag) || tag[i] != ':' || tag[i+1] != '"' {
+			break
+		}
+		name := tag[:i]
+		tag = tag[i+1:]
+
+		i = 1
+		for i < len(tag) && tag[i] != '"' {
+			if tag[i] == '\\' {
+				i++
+			}
+			i++
+		}
+		if i >= len(tag) {
+			break
+		}
+		value, err := strconv.Unquote(tag[:i+1])
+		if err != nil {
+			break
+		}
+		tag = tag[i+1:]
+		ret = append(ret, [2]string{name, value})
+	}
+	return ret
+}
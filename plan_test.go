@@ -0,0 +1,95 @@
+package env
+
+import (
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlanFor(t *testing.T) {
+	type config struct {
+		Home    string `env:"HOME,required"`
+		Inner   *InnerStruct
+		Nested  InnerStruct
+		Servers []InnerStruct `envPrefix:"SERVER"`
+		Ignored string
+		Skipped InnerStruct `env:"-"`
+	}
+
+	plan := planFor(reflect.TypeOf(config{}), "")
+	if assert.Len(t, plan, 6) {
+		assert.Equal(t, fieldValue, plan[0].kind)
+		assert.Equal(t, "HOME", plan[0].key)
+		assert.Equal(t, []string{"required"}, plan[0].opts)
+		assert.Equal(t, fieldPtr, plan[1].kind)
+		assert.Equal(t, fieldNested, plan[2].kind)
+		assert.Equal(t, fieldStructSlice, plan[3].kind)
+		assert.Equal(t, fieldSkip, plan[4].kind)
+		assert.Equal(t, fieldSkip, plan[5].kind)
+		assert.Equal(t, "", plan[5].key)
+	}
+
+	again := planFor(reflect.TypeOf(config{}), "env")
+	assert.Equal(t, &plan[0], &again[0], "plan should be cached")
+}
+
+func TestPlanForConcurrent(t *testing.T) {
+	type config struct {
+		Home string `env:"HOME"`
+		Port int    `env:"PORT"`
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.Len(t, planFor(reflect.TypeOf(config{}), ""), 2)
+		}()
+	}
+	wg.Wait()
+}
+
+func TestPlanForTagName(t *testing.T) {
+	type config struct {
+		Host string `config:"HOST" json:"host"`
+	}
+
+	plan := planFor(reflect.TypeOf(config{}), "config")
+	if assert.Len(t, plan, 1) {
+		assert.Equal(t, reflect.StructTag(`env:"HOST"`), plan[0].field.Tag)
+		assert.Equal(t, reflect.StructTag(`config:"HOST" json:"host"`), plan[0].orig.Tag)
+	}
+}
+
+// renameTags drops the other tags, which user callbacks read from
+// fieldPlan.orig instead.
+func TestRenameTags(t *testing.T) {
+	for tag, expected := range map[reflect.StructTag]reflect.StructTag{
+		`config:"HOST,required" configDefault:"a \"b\"" json:"host"`: `env:"HOST,required" envDefault:"a \"b\""`,
+		`config:"HOST" configuration:"x" env:"OTHER"`:                `env:"HOST"`,
+		`configSeparator:":"`:  `envSeparator:":"`,
+		`json:"host"`:          ``,
+		`config:"HOST" broken`: `env:"HOST"`,
+	} {
+		assert.Equal(t, expected, renameTags(tag, "config"), string(tag))
+	}
+}
+
+func BenchmarkParse(b *testing.B) {
+	os.Setenv("somevar", "somevalue")
+	os.Setenv("intvar", "8080")
+	os.Setenv("durations", "1s,2s")
+	defer os.Clearenv()
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		cfg := Config{}
+		if err := Parse(&cfg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package env
+
+import (
+	"reflect"
+	"strings"
+)
+
+// ValueSource tells where the value of a field comes from, see `FieldReport`.
+type ValueSource string
+
+const (
+	// FromEnv values are read from the variable itself
+	FromEnv ValueSource = "env"
+	// FromDefault values are read from the `envDefault` tag
+	FromDefault ValueSource = "default"
+	// FromFile values are read from the file named by the `_FILE` variable of
+	// an `envFile` field
+	FromFile ValueSource = "file"
+	// NotSet fields have no value at all
+	NotSet ValueSource = ""
+)
+
+// FieldReport describes how a field was read by `ParseWithReport`.
+type FieldReport struct {
+	// Field is the name of the struct field
+	Field string
+	// Key is the name of the environment variable, including its prefix
+	Key string
+	// Value is the value read, or Redacted for a secret which is set
+	Value string
+	// Source tells where Value comes from
+	Source ValueSource
+	// Secret tells whether the field is tagged with `envSecret:"true"`
+	Secret bool
+	// Validations lists the checks applied to the value, e.g. "required",
+	// "oneof=a|b" or "envMin=1"
+	Validations []string
+}
+
+// Report lists the outcome of each field read by `ParseWithReport`, in the
+// order they are read.
+type Report struct {
+	Fields []FieldReport
+}
+
+// ParseWithReport is the same as `Parse`, but also reports the key, value
+// and source of every field, e.g. to expose the configuration on a debug
+// endpoint. The values of secret fields are masked. The report is returned
+// even if parsing fails, and lists the fields read until then.
+func ParseWithReport(v interface{}) (Report, error) {
+	report := Report{}
+	err := ParseWithOptions(v, Options{report: &report})
+	return report, err
+}
+
+func (r *Report) add(field reflect.StructField, key, value string, source ValueSource, validations []string) {
+	secret := isSecret(field)
+	if secret && value != "" {
+		value = Redacted
+	}
+	r.Fields = append(r.Fields, FieldReport{
+		Field:       field.Name,
+		Key:         key,
+		Value:       value,
+		Source:      source,
+		Secret:      secret,
+		Validations: validations,
+	})
+}
+
+// validations lists the checks the tags of the field apply to its value.
+// requiredIfNoDef tells whether the field is required by
+// `Options.RequiredIfNoDef`.
+func validations(field reflect.StructField, opts []string, requiredIfNoDef bool) []string {
+	var ret []string
+	if requiredIfNoDef {
+		ret = append(ret, "required")
+	}
+	for _, opt := range opts {
+		if opt == "required" || opt == "notEmpty" || strings.HasPrefix(opt, "oneof=") {
+			ret = append(ret, opt)
+		}
+	}
+	for _, tag := range []string{"envMin", "envMax", "envMatch"} {
+		if value, ok := field.Tag.Lookup(tag); ok {
+			ret = append(ret, tag+"="+value)
+		}
+	}
+	return ret
+}
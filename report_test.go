@@ -0,0 +1,69 @@
+package env
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseWithReport(t *testing.T) {
+	type database struct {
+		Host string `env:"HOST,required"`
+	}
+	type config struct {
+		Home     string   `env:"HOME"`
+		Port     int      `env:"PORT" envDefault:"3000" envMin:"1"`
+		Level    string   `env:"LEVEL,oneof=debug|info" envTransform:"lower"`
+		Token    string   `env:"TOKEN,notEmpty" envSecret:"true"`
+		Password string   `env:"PASSWORD" envFile:"true" envSecret:"true"`
+		Unset    string   `env:"UNSET" envSecret:"true"`
+		DB       database `envPrefix:"DB_"`
+	}
+
+	f, err := ioutil.TempFile("", "env")
+	assert.NoError(t, err)
+	defer os.Remove(f.Name())
+	f.WriteString("s3cr3t\n")
+	f.Close()
+
+	os.Setenv("HOME", "/home/me")
+	os.Setenv("LEVEL", "INFO")
+	os.Setenv("TOKEN", "t0k3n")
+	os.Setenv("PASSWORD_FILE", f.Name())
+	os.Setenv("DB_HOST", "db")
+	defer os.Clearenv()
+
+	cfg := &config{}
+	report, err := ParseWithReport(cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, "t0k3n", cfg.Token)
+	assert.Equal(t, "s3cr3t", cfg.Password)
+	assert.Equal(t, []FieldReport{
+		{Field: "Home", Key: "HOME", Value: "/home/me", Source: FromEnv},
+		{Field: "Port", Key: "PORT", Value: "3000", Source: FromDefault, Validations: []string{"envMin=1"}},
+		{Field: "Level", Key: "LEVEL", Value: "info", Source: FromEnv, Validations: []string{"oneof=debug|info"}},
+		{Field: "Token", Key: "TOKEN", Value: Redacted, Source: FromEnv, Secret: true, Validations: []string{"notEmpty"}},
+		{Field: "Password", Key: "PASSWORD", Value: Redacted, Source: FromFile, Secret: true},
+		{Field: "Unset", Key: "UNSET", Source: NotSet, Secret: true},
+		{Field: "Host", Key: "DB_HOST", Value: "db", Source: FromEnv, Validations: []string{"required"}},
+	}, report.Fields)
+}
+
+func TestParseWithReportError(t *testing.T) {
+	type config struct {
+		Home string `env:"HOME"`
+		Port int    `env:"PORT,required"`
+	}
+
+	os.Setenv("HOME", "/home/me")
+	defer os.Clearenv()
+
+	report, err := ParseWithReport(&config{})
+	assert.Error(t, err)
+	if assert.Len(t, report.Fields, 2) {
+		assert.Equal(t, "HOME", report.Fields[0].Key)
+		assert.Equal(t, NotSet, report.Fields[1].Source)
+	}
+}
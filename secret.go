@@ -0,0 +1,47 @@
+package env
+
+import "reflect"
+
+// Redacted replaces the value of the fields tagged with `envSecret:"true"` in
+// errors and reports.
+const Redacted = "***"
+
+// isSecret reports whether the value of the field must not be shown.
+func isSecret(field reflect.StructField) bool {
+	return field.Tag.Get("envSecret") == "true"
+}
+
+// redactedError hides the message of err, which may quote the secret value
+// or a part of it, like a custom parser quoting its input or the element of a
+// slice which failed. err is still reachable with errors.Is and errors.As.
+type redactedError struct {
+	err error
+}
+
+func (e *redactedError) Error() string {
+	return "details hidden for secret value"
+}
+
+// Unwrap returns the underlying error.
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
+
+// newParseError returns a ParseError for the field, with the value redacted
+// if the field is a secret.
+func newParseError(field reflect.StructField, key, value string, err error) *ParseError {
+	if isSecret(field) && value != "" {
+		return &ParseError{
+			Field: field.Name,
+			Key:   key,
+			Value: Redacted,
+			Err:   &redactedError{err: err},
+		}
+	}
+	return &ParseError{
+		Field: field.Name,
+		Key:   key,
+		Value: value,
+		Err:   err,
+	}
+}
@@ -0,0 +1,90 @@
+package env
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSecretErrors(t *testing.T) {
+	type config struct {
+		Port  int    `env:"PORT" envSecret:"true"`
+		Level string `env:"LEVEL,oneof=debug|info" envSecret:"true"`
+		Pin   int    `env:"PIN" envMin:"1000" envSecret:"true"`
+	}
+	defer os.Clearenv()
+
+	for key, value := range map[string]string{
+		"PORT":  "s3cr3t",
+		"LEVEL": "s3cr3t",
+		"PIN":   "42",
+	} {
+		os.Clearenv()
+		os.Setenv(key, value)
+		err := Parse(&config{})
+		if assert.Error(t, err, key) {
+			assert.NotContains(t, err.Error(), value, key)
+			assert.Contains(t, err.Error(), key, key)
+		}
+	}
+
+	os.Clearenv()
+	os.Setenv("PORT", "s3cr3t")
+	err := Parse(&config{})
+	var perr *ParseError
+	if assert.True(t, errors.As(err, &perr)) {
+		assert.Equal(t, "Port", perr.Field)
+		assert.Equal(t, Redacted, perr.Value)
+		assert.True(t, errors.Is(err, strconv.ErrSyntax))
+	}
+}
+
+func TestSecretErrorsSlice(t *testing.T) {
+	type config struct {
+		Pins []int `env:"PINS" envSecret:"true"`
+	}
+
+	os.Setenv("PINS", "1234,s3cr3t,5678")
+	defer os.Clearenv()
+
+	err := Parse(&config{})
+	if assert.Error(t, err) {
+		assert.NotContains(t, err.Error(), "s3cr3t")
+		assert.NotContains(t, err.Error(), "1234")
+		assert.Contains(t, err.Error(), "PINS")
+		assert.Contains(t, err.Error(), "Pins")
+		assert.True(t, errors.Is(err, strconv.ErrSyntax))
+	}
+}
+
+func TestSecretErrorsCustomParser(t *testing.T) {
+	type token string
+	type config struct {
+		Token token  `env:"TOKEN" envSecret:"true"`
+		Other token  `env:"OTHER"`
+		Name  string `env:"NAME"`
+	}
+
+	os.Setenv("TOKEN", "s3cr3t")
+	os.Setenv("OTHER", "visible")
+	defer os.Clearenv()
+
+	err := ParseWithOptions(&config{}, Options{
+		CollectAllErrors: true,
+		CustomParsers: CustomParsers{
+			reflect.TypeOf(token("")): func(v string) (interface{}, error) {
+				return nil, fmt.Errorf("invalid token %q", v)
+			},
+		},
+	})
+	if assert.Error(t, err) {
+		assert.NotContains(t, err.Error(), "s3cr3t")
+		assert.Contains(t, err.Error(), "Token")
+		assert.Contains(t, err.Error(), "visible")
+	}
+}
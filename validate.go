@@ -0,0 +1,63 @@
+package env
+
+import (
+	"context"
+	"reflect"
+)
+
+// Validate runs `Parse` for v, a struct or a pointer to a struct, against a
+// scratch copy and reports every problem found as an *AggregateError. v itself
+// is never modified, so it does not need to be a pointer. Nested structs behind
+// untagged pointers are only checked when the pointer is not nil, as `Parse`
+// would do.
+func Validate(v interface{}) error {
+	return ValidateWithOptions(v, Options{})
+}
+
+// ValidateWithOptions is the same as `Validate` except its behavior can be
+// tuned with opts, like `ParseWithOptions`. CollectAllErrors is always set.
+func ValidateWithOptions(v interface{}, opts Options) error {
+	ref := reflect.Indirect(reflect.ValueOf(v))
+	if ref.Kind() != reflect.Struct {
+		return ErrNotAStructPtr
+	}
+
+	scratch := reflect.New(ref.Type()).Elem()
+	allocPointers(ref, scratch, opts.TagName)
+	opts.CollectAllErrors = true
+	opts.dryRun = true
+	if len(opts.Prefixes) > 0 {
+		opts.Prefix = opts.Prefixes[0]
+	}
+	if opts.Strict {
+		opts.known = make(map[string]bool)
+	}
+	if opts.ContextSource != nil {
+		opts.lookupCtx = &contextLookup{ctx: context.Background(), source: opts.ContextSource}
+	}
+	err := withCheckErrors(doParse(scratch, opts.parsers(), opts.Prefix, opts), opts)
+	if opts.lookupCtx != nil && opts.lookupCtx.err != nil {
+		return opts.lookupCtx.err
+	}
+	return err
+}
+
+// allocPointers points the untagged struct pointers of dst, which holds the
+// zero value of the type of src, to fresh structs wherever src has a non-nil
+// one, so that parsing dst never writes through the pointers of src.
+func allocPointers(src, dst reflect.Value, tagName string) {
+	for _, fp := range planFor(src.Type(), tagName) {
+		field := src.Field(fp.index)
+		switch fp.kind {
+		case fieldPtr:
+			if field.IsNil() || field.Elem().Kind() != reflect.Struct {
+				continue
+			}
+			ptr := reflect.New(field.Type().Elem())
+			allocPointers(field.Elem(), ptr.Elem(), tagName)
+			dst.Field(fp.index).Set(ptr)
+		case fieldNested:
+			allocPointers(field, dst.Field(fp.index), tagName)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package env
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	type nested struct {
+		Level string `env:"LEVEL" envMatch:"^(debug|info)$"`
+	}
+	type config struct {
+		Home   string `env:"HOME,required"`
+		Port   int    `env:"PORT" envMin:"1"`
+		Debug  bool   `env:"DEBUG"`
+		Log    nested `envPrefix:"LOG_"`
+		Inner  *InnerStruct
+		Unused *InnerStruct
+	}
+
+	os.Setenv("PORT", "0")
+	os.Setenv("DEBUG", "maybe")
+	os.Setenv("LOG_LEVEL", "trace")
+	os.Setenv("innernum", "nan")
+	defer os.Clearenv()
+
+	inner := &InnerStruct{Inner: "untouched"}
+	cfg := config{Inner: inner}
+	err := Validate(cfg)
+	var agg *AggregateError
+	if assert.True(t, errors.As(err, &agg)) {
+		assert.Len(t, agg.Errors, 5)
+	}
+	assert.Equal(t, config{Inner: inner}, cfg)
+	assert.Equal(t, &InnerStruct{Inner: "untouched"}, inner)
+}
+
+func TestValidateNoSideEffects(t *testing.T) {
+	type config struct {
+		Secret string `env:"SECRET,unset"`
+		Port   int    `env:"PORT" envDefault:"3000"`
+		Old    string `env:"OLD" envDeprecated:"use NEW"`
+	}
+
+	os.Setenv("SECRET", "s3cr3t")
+	os.Setenv("OLD", "x")
+	defer os.Clearenv()
+
+	var deprecated []string
+	assert.NoError(t, ValidateWithOptions(config{}, Options{
+		ExportDefaults: true,
+		OnDeprecated: func(key, message string) {
+			deprecated = append(deprecated, key)
+		},
+	}))
+	assert.Equal(t, "s3cr3t", os.Getenv("SECRET"))
+	_, ok := os.LookupEnv("PORT")
+	assert.False(t, ok)
+	assert.Empty(t, deprecated)
+}
+
+func TestValidateValid(t *testing.T) {
+	type config struct {
+		Home string `env:"HOME,required"`
+		Port int    `env:"PORT" envDefault:"3000"`
+	}
+
+	os.Setenv("APP_HOME", "/home/me")
+	defer os.Clearenv()
+
+	cfg := &config{}
+	assert.NoError(t, ValidateWithOptions(cfg, Options{Prefix: "APP_"}))
+	assert.Equal(t, &config{}, cfg)
+	assert.Equal(t, ErrNotAStructPtr, Validate("not a struct"))
+}
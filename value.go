@@ -0,0 +1,32 @@
+package env
+
+import (
+	"reflect"
+	"strconv"
+)
+
+// ParseValue converts raw into a value of type t with the same rules as
+// `Parse` uses for struct fields, without the struct. sep splits slices and
+// map entries, and defaults to ",". It returns ErrUnsupportedType for types
+// which are not supported.
+func ParseValue(t reflect.Type, raw string, sep string) (interface{}, error) {
+	return ParseValueWithFuncs(t, raw, sep, nil)
+}
+
+// ParseValueWithFuncs is the same as `ParseValue` except it also uses the
+// given custom parsers, like `ParseWithFuncs`.
+func ParseValueWithFuncs(t reflect.Type, raw string, sep string, funcMap CustomParsers) (interface{}, error) {
+	if t == nil {
+		return nil, ErrUnsupportedType
+	}
+	field := reflect.StructField{Name: t.String(), Type: t}
+	if sep != "" {
+		field.Tag = reflect.StructTag("envSeparator:" + strconv.Quote(sep))
+	}
+
+	v := reflect.New(t).Elem()
+	if err := set(v, field, raw, funcMap, nil, nil); err != nil {
+		return nil, err
+	}
+	return v.Interface(), nil
+}
@@ -0,0 +1,67 @@
+package env
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseValue(t *testing.T) {
+	for _, tt := range []struct {
+		t        reflect.Type
+		raw      string
+		sep      string
+		expected interface{}
+	}{
+		{reflect.TypeOf(0), "42", "", 42},
+		{reflect.TypeOf(float64(0)), "0.5", "", 0.5},
+		{reflect.TypeOf(time.Duration(0)), "1m", "", time.Minute},
+		{reflect.TypeOf(false), "true", "", true},
+		{reflect.TypeOf([]int(nil)), "1,2", "", []int{1, 2}},
+		{reflect.TypeOf([]string(nil)), "a||b", "||", []string{"a", "b"}},
+		{reflect.TypeOf([]time.Duration(nil)), "1s;2s", ";", []time.Duration{time.Second, 2 * time.Second}},
+		{reflect.TypeOf(map[string]int(nil)), "a:1", "", map[string]int{"a": 1}},
+		{reflect.TypeOf(net.IP(nil)), "127.0.0.1", "", net.ParseIP("127.0.0.1")},
+		{reflect.TypeOf((*int)(nil)), "7", "", func() *int { i := 7; return &i }()},
+	} {
+		v, err := ParseValue(tt.t, tt.raw, tt.sep)
+		assert.NoError(t, err, tt.t.String())
+		assert.Equal(t, tt.expected, v, tt.t.String())
+	}
+}
+
+func TestParseValueErrors(t *testing.T) {
+	_, err := ParseValue(reflect.TypeOf(0), "nope", "")
+	assert.Error(t, err)
+
+	_, err = ParseValue(reflect.TypeOf(make(chan int)), "x", "")
+	assert.Equal(t, ErrUnsupportedType, err)
+
+	_, err = ParseValue(nil, "x", "")
+	assert.Equal(t, ErrUnsupportedType, err)
+}
+
+func TestParseValueWithFuncs(t *testing.T) {
+	type foobar struct {
+		name string
+	}
+	parsers := CustomParsers{
+		reflect.TypeOf(foobar{}): func(v string) (interface{}, error) {
+			if v == "" {
+				return nil, errors.New("empty")
+			}
+			return foobar{name: v}, nil
+		},
+	}
+
+	v, err := ParseValueWithFuncs(reflect.TypeOf(foobar{}), "bar", "", parsers)
+	assert.NoError(t, err)
+	assert.Equal(t, foobar{name: "bar"}, v)
+
+	_, err = ParseValueWithFuncs(reflect.TypeOf(foobar{}), "", "", parsers)
+	assert.EqualError(t, err, "Custom parser error: empty")
+}